@@ -1,4 +1,6 @@
-import React, { createContext, useContext, ReactNode } from "react";
+import React, { createContext, useContext, useEffect, ReactNode } from "react";
+import { useQueryClient } from "@tanstack/react-query";
+import { apiService } from "@/services/apiService";
 import { Script, AppConfig, CategoryResponse } from "@/types/script";
 import { useToast } from "@/hooks/use-toast";
 import { useAppConfig, useScripts, useRecentScripts, useCategories, useReloadScripts } from "@/hooks/useApi";
@@ -35,6 +37,18 @@ export function ScriptsProvider({ children }: ScriptsProviderProps) {
   const { data: categoriesData = [], isLoading: categoriesLoading } = useCategories();
   const { data: recentScriptsData = [], isLoading: recentLoading } = useRecentScripts();
   const { mutateAsync: reloadScripts } = useReloadScripts();
+  const queryClient = useQueryClient();
+
+  // Refresh the catalog when the server notices script files changing on disk
+  useEffect(() => {
+    return apiService.subscribeToEvents((type) => {
+      if (type === "scripts.changed") {
+        queryClient.invalidateQueries({ queryKey: ['scripts'] });
+        queryClient.invalidateQueries({ queryKey: ['recentScripts'] });
+        queryClient.invalidateQueries({ queryKey: ['categories'] });
+      }
+    });
+  }, [queryClient]);
 
   const loading = scriptsLoading || configLoading || categoriesLoading || recentLoading;
   const error = scriptsError ? "Failed to load scripts" : null;
@@ -13,6 +13,8 @@ interface ApiScriptResponse {
   inputs: ScriptInput[];
   path: string;
   content?: string;
+  favorite?: boolean;
+  pinned?: boolean;
 }
 
 interface ApiExecutionResponse {
@@ -30,6 +32,11 @@ interface ApiExecutionResponse {
   incognito: boolean;
 }
 
+interface ScriptFlags {
+  favorite: boolean;
+  pinned: boolean;
+}
+
 interface CategoryResponse {
   category: string;
   count: number;
@@ -95,6 +102,8 @@ export const apiService = {
       tags: s.tags,
       inputs: s.inputs,
       path: s.path,
+      favorite: s.favorite,
+      pinned: s.pinned,
       lastExecuted: undefined
     }));
   },
@@ -111,6 +120,8 @@ export const apiService = {
       tags: s.tags,
       inputs: s.inputs,
       path: s.path,
+      favorite: s.favorite,
+      pinned: s.pinned,
       lastExecuted: undefined
     }));
   },
@@ -134,6 +145,8 @@ export const apiService = {
         inputs: s.inputs,
         path: s.path,
         content: s.content,
+        favorite: s.favorite,
+        pinned: s.pinned,
         lastExecuted: undefined
       };
     } catch (error) {
@@ -141,8 +154,18 @@ export const apiService = {
     }
   },
 
-  toggleFavorite: async (id: string): Promise<Script | undefined> => {
-    return apiService.getScriptById(id);
+  setFavorite: async (id: string, favorite: boolean): Promise<ScriptFlags> => {
+    const { data } = favorite
+      ? await api.put<ScriptFlags>(`/scripts/${id}/favorite`)
+      : await api.delete<ScriptFlags>(`/scripts/${id}/favorite`);
+    return { favorite: data.favorite, pinned: data.pinned };
+  },
+
+  setPinned: async (id: string, pinned: boolean): Promise<ScriptFlags> => {
+    const { data } = pinned
+      ? await api.put<ScriptFlags>(`/scripts/${id}/pin`)
+      : await api.delete<ScriptFlags>(`/scripts/${id}/pin`);
+    return { favorite: data.favorite, pinned: data.pinned };
   },
 
   getExecutions: async (): Promise<ScriptExecution[]> => {
@@ -210,5 +233,38 @@ export const apiService = {
 
   deleteHistory: async (id: string): Promise<void> => {
     await api.delete(`/history/${id}`);
+  },
+
+  // Subscribes to server events (e.g. scripts.changed); returns an unsubscribe function.
+  // EventSource cannot send the API key, so each connection uses a single-use
+  // ticket and reconnects with a new one when the stream drops.
+  subscribeToEvents: (onEvent: (type: string, data: unknown) => void): (() => void) => {
+    let source: EventSource | null = null;
+    let retry: ReturnType<typeof setTimeout> | undefined;
+    let closed = false;
+    const handler = (e: MessageEvent) => {
+      const event = JSON.parse(e.data);
+      onEvent(event.type, event.data);
+    };
+    const connect = async () => {
+      try {
+        const { data } = await api.post<{ ticket: string }>('/stream-tickets');
+        if (closed) return;
+        source = new EventSource(`${API_BASE}/events?ticket=${encodeURIComponent(data.ticket)}`);
+        source.addEventListener('scripts.changed', handler);
+        source.onerror = () => {
+          source?.close();
+          if (!closed) retry = setTimeout(connect, 3000);
+        };
+      } catch {
+        if (!closed) retry = setTimeout(connect, 3000);
+      }
+    };
+    connect();
+    return () => {
+      closed = true;
+      clearTimeout(retry);
+      source?.close();
+    };
   }
 };
@@ -18,6 +18,8 @@ export interface Script {
   path: string;
   lastExecuted?: string;
   content?: string;
+  favorite?: boolean;
+  pinned?: boolean;
 }
 
 export interface ExecutionConfig {
@@ -21,7 +21,7 @@ func main() {
 	// Build for each target
 	for _, target := range targets {
 		log.Printf("Building for %s/%s...\n", target.OS, target.Arch)
-		cmd := exec.Command("wails", "build", "-platform", target.OS+"/"+target.Arch)
+		cmd := exec.Command("wails", "build", "-tags", "sqlite_fts5", "-platform", target.OS+"/"+target.Arch)
 		cmd.Env = append(os.Environ(), "GOOS="+target.OS, "GOARCH="+target.Arch)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
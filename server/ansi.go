@@ -0,0 +1,471 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Output formats accepted by ?format= on the exec and history endpoints.
+const (
+	formatPlain = "plain" // text only, escape sequences removed
+	formatANSI  = "ansi"  // text with color and style sequences kept
+	formatHTML  = "html"  // text with styles as <span style="...">, HTML escaped
+)
+
+var outputFormats = []string{formatPlain, formatANSI, formatHTML}
+
+// ansiStyle is the graphic rendition of a character. Colors hold the SGR
+// parameters that select them, e.g. "31", "38;5;208" or "38;2;255;0;0".
+type ansiStyle struct {
+	Fg, Bg    string
+	Bold      bool
+	Dim       bool
+	Italic    bool
+	Underline bool
+	Inverse   bool
+	Strike    bool
+}
+
+// ansiCell is one character on the screen. Its style is an index into
+// ansiScreen.styles, which keeps cells small for large outputs.
+type ansiCell struct {
+	r     rune
+	style uint32
+}
+
+// ansiSpan is a run of text sharing one style.
+type ansiSpan struct {
+	Text  string
+	Style ansiStyle
+}
+
+// ansiScreen replays terminal output into lines, applying carriage returns,
+// backspaces, line erases and cursor movement so that progress bars and
+// spinners collapse into their final state.
+type ansiScreen struct {
+	lines  [][]ansiCell
+	row    int
+	col    int
+	style  ansiStyle
+	cur    uint32               // index of style in styles
+	pad    int                  // blank cells left to fill gaps that cursor moves open up
+	styles []ansiStyle          // styles used so far, the default first
+	ids    map[ansiStyle]uint32 // index of each style in styles
+}
+
+// maxColumn bounds the cursor column. Together with the padding budget of
+// ansiScreen, which is the length of the output, it keeps a few bytes of
+// cursor movement from allocating huge lines.
+const maxColumn = 4096
+
+// parseANSI interprets output as a terminal would and returns its lines as
+// styled spans. Sequences that do not affect the text, such as window
+// titles, cursor visibility and screen clears, are dropped.
+func parseANSI(output string) [][]ansiSpan {
+	s := &ansiScreen{lines: [][]ansiCell{nil}, pad: len(output), ids: map[ansiStyle]uint32{{}: 0}, styles: []ansiStyle{{}}}
+	for i := 0; i < len(output); {
+		c := output[i]
+		switch {
+		case c == 0x1b:
+			i = s.escape(output, i)
+			continue
+		case c == '\n':
+			s.moveTo(s.row+1, 0)
+		case c == '\r':
+			s.col = 0
+		case c == '\b':
+			if s.col > 0 {
+				s.col--
+			}
+		case c == '\t' || c >= 0x20:
+			r, size := rune(c), 1
+			if c >= 0x80 {
+				r, size = utf8.DecodeRuneInString(output[i:])
+			}
+			s.put(r)
+			i += size
+			continue
+		}
+		i++
+	}
+	// Output ending in a newline does not start another line
+	if len(s.lines) > 1 && len(s.lines[len(s.lines)-1]) == 0 {
+		s.lines = s.lines[:len(s.lines)-1]
+	}
+
+	result := make([][]ansiSpan, len(s.lines))
+	for n, line := range s.lines {
+		var spans []ansiSpan
+		var text strings.Builder
+		for j, cell := range line {
+			if j > 0 && cell.style != line[j-1].style {
+				spans = append(spans, ansiSpan{Text: text.String(), Style: s.styles[line[j-1].style]})
+				text.Reset()
+			}
+			text.WriteRune(cell.r)
+		}
+		if len(line) > 0 {
+			spans = append(spans, ansiSpan{Text: text.String(), Style: s.styles[line[len(line)-1].style]})
+		}
+		result[n] = spans
+	}
+	return result
+}
+
+func (s *ansiScreen) moveTo(row, col int) {
+	if row < 0 {
+		row = 0
+	}
+	for len(s.lines) <= row {
+		s.lines = append(s.lines, nil)
+	}
+	s.row, s.col = row, min(max(col, 0), maxColumn)
+}
+
+func (s *ansiScreen) put(r rune) {
+	line := s.lines[s.row]
+	if gap := s.col - len(line); gap > s.pad {
+		s.col = len(line) + s.pad
+	}
+	for len(line) < s.col {
+		line = append(line, ansiCell{r: ' '})
+		s.pad--
+	}
+	if s.col < len(line) {
+		line[s.col] = ansiCell{r: r, style: s.cur}
+	} else {
+		line = append(line, ansiCell{r: r, style: s.cur})
+	}
+	s.lines[s.row] = line
+	s.col++
+}
+
+// escape handles the escape sequence starting at output[i] and returns the
+// index after it.
+func (s *ansiScreen) escape(output string, i int) int {
+	if i+1 >= len(output) {
+		return len(output)
+	}
+	switch output[i+1] {
+	case '[':
+		// CSI: parameter and intermediate bytes, then a final byte
+		j := i + 2
+		for j < len(output) && (output[j] < 0x40 || output[j] > 0x7e) {
+			j++
+		}
+		if j == len(output) {
+			return j
+		}
+		s.csi(output[i+2:j], output[j])
+		return j + 1
+	case ']', 'P', '_', '^':
+		// OSC and other strings end with BEL or ST (ESC \)
+		for j := i + 2; j < len(output); j++ {
+			if output[j] == 0x07 {
+				return j + 1
+			}
+			if output[j] == 0x1b && j+1 < len(output) && output[j+1] == '\\' {
+				return j + 2
+			}
+		}
+		return len(output)
+	}
+	// Other sequences: intermediate bytes, then a final byte
+	j := i + 1
+	for j < len(output) && output[j] >= 0x20 && output[j] <= 0x2f {
+		j++
+	}
+	return min(j+1, len(output))
+}
+
+func (s *ansiScreen) csi(params string, final byte) {
+	if strings.IndexAny(params, "?<=>") == 0 {
+		return // private modes such as cursor visibility
+	}
+	n := func(def int) int {
+		v, err := strconv.Atoi(strings.SplitN(params, ";", 2)[0])
+		if err != nil || v <= 0 {
+			return def
+		}
+		return min(v, maxColumn)
+	}
+	line := s.lines[s.row]
+	switch final {
+	case 'm':
+		s.style = s.style.apply(params)
+		id, ok := s.ids[s.style]
+		if !ok {
+			id = uint32(len(s.styles))
+			s.ids[s.style] = id
+			s.styles = append(s.styles, s.style)
+		}
+		s.cur = id
+	case 'K':
+		switch n(0) {
+		case 0:
+			if s.col < len(line) {
+				s.lines[s.row] = line[:s.col]
+			}
+		case 1:
+			// Up to and including the cursor, as ECMA-48 specifies
+			for j := 0; j <= s.col && j < len(line); j++ {
+				line[j] = ansiCell{r: ' '}
+			}
+		case 2:
+			s.lines[s.row] = nil
+		}
+	case 'J':
+		// Erasing below the cursor is used to redraw multi-line progress;
+		// whole screen clears are ignored so earlier output is kept
+		if n(0) == 0 {
+			if s.col < len(line) {
+				s.lines[s.row] = line[:s.col]
+			}
+			s.lines = s.lines[:s.row+1]
+		}
+	case 'A', 'F':
+		col := s.col
+		if final == 'F' {
+			col = 0
+		}
+		s.moveTo(s.row-n(1), col)
+	case 'B', 'E':
+		// As on a terminal scrolled to its end, the cursor stops at the
+		// last line; only output opens new ones
+		col := s.col
+		if final == 'E' {
+			col = 0
+		}
+		s.moveTo(min(s.row+n(1), len(s.lines)-1), col)
+	case 'C':
+		s.moveTo(s.row, s.col+n(1))
+	case 'D':
+		s.moveTo(s.row, s.col-n(1))
+	case 'G':
+		s.moveTo(s.row, n(1)-1)
+	}
+}
+
+// apply returns the style after the SGR parameters params.
+func (st ansiStyle) apply(params string) ansiStyle {
+	codes := strings.FieldsFunc(strings.ReplaceAll(params, ":", ";"), func(r rune) bool { return r == ';' })
+	if len(codes) == 0 {
+		return ansiStyle{}
+	}
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case code == 0:
+			st = ansiStyle{}
+		case code == 1:
+			st.Bold = true
+		case code == 2:
+			st.Dim = true
+		case code == 3:
+			st.Italic = true
+		case code == 4:
+			st.Underline = true
+		case code == 7:
+			st.Inverse = true
+		case code == 9:
+			st.Strike = true
+		case code == 22:
+			st.Bold, st.Dim = false, false
+		case code == 23:
+			st.Italic = false
+		case code == 24:
+			st.Underline = false
+		case code == 27:
+			st.Inverse = false
+		case code == 29:
+			st.Strike = false
+		case code >= 30 && code <= 37 || code >= 90 && code <= 97:
+			st.Fg = codes[i]
+		case code == 39:
+			st.Fg = ""
+		case code >= 40 && code <= 47 || code >= 100 && code <= 107:
+			st.Bg = codes[i]
+		case code == 49:
+			st.Bg = ""
+		case code == 38 || code == 48:
+			// Extended colors: 5;n or 2;r;g;b
+			size := 0
+			if i+1 < len(codes) && codes[i+1] == "5" {
+				size = 2
+			} else if i+1 < len(codes) && codes[i+1] == "2" {
+				size = 4
+			}
+			if size == 0 || i+size >= len(codes) {
+				return st
+			}
+			color := strings.Join(codes[i:i+size+1], ";")
+			if code == 38 {
+				st.Fg = color
+			} else {
+				st.Bg = color
+			}
+			i += size
+		}
+	}
+	return st
+}
+
+// sgr returns the escape sequence selecting the style from the default.
+func (st ansiStyle) sgr() string {
+	var codes []string
+	for _, attr := range []struct {
+		on   bool
+		code string
+	}{{st.Bold, "1"}, {st.Dim, "2"}, {st.Italic, "3"}, {st.Underline, "4"}, {st.Inverse, "7"}, {st.Strike, "9"}} {
+		if attr.on {
+			codes = append(codes, attr.code)
+		}
+	}
+	if st.Fg != "" {
+		codes = append(codes, st.Fg)
+	}
+	if st.Bg != "" {
+		codes = append(codes, st.Bg)
+	}
+	if len(codes) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// ansiPalette holds the 16 basic terminal colors, normal then bright.
+var ansiPalette = [16]string{
+	"#000000", "#cd3131", "#0dbc79", "#e5e510", "#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+	"#666666", "#f14c4c", "#23d18b", "#f5f543", "#3b8eea", "#d670d6", "#29b8db", "#ffffff",
+}
+
+// cssColor converts the SGR parameters of a color into a CSS color.
+func cssColor(sgr string) string {
+	parts := strings.Split(sgr, ";")
+	code, _ := strconv.Atoi(parts[0])
+	switch {
+	case len(parts) == 3 && parts[1] == "5":
+		n, _ := strconv.Atoi(parts[2])
+		switch {
+		case n < 16:
+			return ansiPalette[n]
+		case n < 232:
+			n -= 16
+			level := func(v int) int {
+				if v == 0 {
+					return 0
+				}
+				return 55 + v*40
+			}
+			return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+		default:
+			gray := 8 + (n-232)*10
+			return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+		}
+	case len(parts) == 5 && parts[1] == "2":
+		r, _ := strconv.Atoi(parts[2])
+		g, _ := strconv.Atoi(parts[3])
+		b, _ := strconv.Atoi(parts[4])
+		return fmt.Sprintf("#%02x%02x%02x", r&0xff, g&0xff, b&0xff)
+	case code >= 30 && code <= 37:
+		return ansiPalette[code-30]
+	case code >= 40 && code <= 47:
+		return ansiPalette[code-40]
+	case code >= 90 && code <= 97:
+		return ansiPalette[code-90+8]
+	case code >= 100 && code <= 107:
+		return ansiPalette[code-100+8]
+	}
+	return ""
+}
+
+// css returns the inline CSS of the style.
+func (st ansiStyle) css() string {
+	fg, bg := cssColor(st.Fg), cssColor(st.Bg)
+	if st.Inverse {
+		// Swap with the page colors when a color is the default
+		if fg == "" {
+			fg = "CanvasText"
+		}
+		if bg == "" {
+			bg = "Canvas"
+		}
+		fg, bg = bg, fg
+	}
+	var rules []string
+	if fg != "" {
+		rules = append(rules, "color:"+fg)
+	}
+	if bg != "" {
+		rules = append(rules, "background-color:"+bg)
+	}
+	if st.Bold {
+		rules = append(rules, "font-weight:bold")
+	}
+	if st.Dim {
+		rules = append(rules, "opacity:0.7")
+	}
+	if st.Italic {
+		rules = append(rules, "font-style:italic")
+	}
+	var decorations []string
+	if st.Underline {
+		decorations = append(decorations, "underline")
+	}
+	if st.Strike {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		rules = append(rules, "text-decoration:"+strings.Join(decorations, " "))
+	}
+	return strings.Join(rules, ";")
+}
+
+// renderOutput renders captured output in one of outputFormats. Every
+// format collapses overwritten lines; ansi output resets styles at the end
+// of each line so lines can be shown on their own.
+func renderOutput(output, format string) string {
+	lines := parseANSI(output)
+	var b strings.Builder
+	for n, line := range lines {
+		if n > 0 {
+			b.WriteByte('\n')
+		}
+		for _, span := range line {
+			switch format {
+			case formatPlain:
+				b.WriteString(span.Text)
+			case formatHTML:
+				if css := span.Style.css(); css != "" {
+					fmt.Fprintf(&b, `<span style="%s">%s</span>`, css, html.EscapeString(span.Text))
+				} else {
+					b.WriteString(html.EscapeString(span.Text))
+				}
+			default:
+				if sgr := span.Style.sgr(); sgr != "" {
+					b.WriteString(sgr + span.Text + "\x1b[0m")
+				} else {
+					b.WriteString(span.Text)
+				}
+			}
+		}
+	}
+	if len(lines) > 0 && strings.HasSuffix(output, "\n") {
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// checkOutputFormat validates a ?format= value; empty means the stored output.
+func checkOutputFormat(format string) error {
+	if format != "" && !containsString(outputFormats, format) {
+		return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(outputFormats, ", "))
+	}
+	return nil
+}
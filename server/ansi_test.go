@@ -0,0 +1,48 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		format string
+		want   string
+	}{
+		{"carriage return collapses progress", "downloading  10%\rdownloading 100%\ndone\n", formatPlain, "downloading 100%\ndone\n"},
+		{"overwrite keeps longer tail", "abcdef\rxy\n", formatPlain, "xycdef\n"},
+		{"backspace", "ab\bc\n", formatPlain, "ac\n"},
+		{"erase to end of line", "abcdef\r\x1b[Kxy\n", formatPlain, "xy\n"},
+		{"erase whole line", "abcdef\x1b[2K\rxy\n", formatPlain, "xy\n"},
+		{"erase to start of line", "abcdef\x1b[1K\n", formatPlain, "      \n"},
+		{"erase to start of line includes the cursor", "abcdef\x1b[3D\x1b[1K\n", formatPlain, "    ef\n"},
+		{"cursor up redraws lines", "a 1\nb 1\n\x1b[2Aa 2\nb 2\n", formatPlain, "a 2\nb 2\n"},
+		{"window title dropped", "\x1b]0;title\x07hi\n", formatPlain, "hi\n"},
+		{"sgr stripped in plain", "\x1b[31mred\x1b[0m plain\n", formatPlain, "red plain\n"},
+		{"sgr kept in ansi", "\x1b[31mred\x1b[0m plain\n", formatANSI, "\x1b[31mred\x1b[0m plain\n"},
+		{"sgr as html", "\x1b[31mred\x1b[0m plain\n", formatHTML, "<span style=\"color:#cd3131\">red</span> plain\n"},
+		{"256 color and bold reset", "\x1b[1;38;5;208mx\x1b[22my", formatANSI, "\x1b[1;38;5;208mx\x1b[0m\x1b[38;5;208my\x1b[0m"},
+		{"html escaped", "a<b\x1b[4mu", formatHTML, "a&lt;b<span style=\"text-decoration:underline\">u</span>"},
+		{"column move is bounded by output", "\x1b[5000000Gx", formatPlain, strings.Repeat(" ", 11) + "x"},
+		{"relative column move is bounded by output", "\x1b[50000000Cx", formatPlain, strings.Repeat(" ", 12) + "x"},
+		{"row move stops at last line", "a\x1b[50000000Bx\n", formatPlain, "ax\n"},
+		{"next line stops at last line", "a\x1b[50000000Ex\n", formatPlain, "x\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderOutput(tt.in, tt.format); got != tt.want {
+				t.Errorf("renderOutput(%q, %s) = %q, want %q", tt.in, tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderOutputBoundsPadding(t *testing.T) {
+	in := strings.Repeat("\x1b[4096Gx\n", 1000)
+	if got := renderOutput(in, formatPlain); len(got) > 2*len(in) {
+		t.Errorf("rendered %d bytes of output into %d bytes", len(in), len(got))
+	}
+}
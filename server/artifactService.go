@@ -0,0 +1,138 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// artifactsEnv names the folder a script may leave files in to keep them
+// with its history entry.
+const artifactsEnv = "DEVLOOP_ARTIFACTS"
+
+// Artifact is a file a run left in its DEVLOOP_ARTIFACTS folder.
+type Artifact struct {
+	ID        string    `json:"id"`
+	HistoryID string    `json:"history_id"`
+	Name      string    `json:"name"` // path relative to the artifacts folder, with forward slashes
+	Size      int64     `json:"size"`
+	MimeType  string    `json:"mime_type"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// artifactsDir returns the folder holding the artifacts of a history entry.
+// It is removed together with the entry by DeleteHistoryByID.
+func artifactsDir(historyID string) string {
+	return filepath.Join(getConfigFolderPath(), "artifacts", historyID)
+}
+
+// isPathElement reports whether id can be used as a single file name, so a
+// path built from it stays inside its parent folder.
+func isPathElement(id string) bool {
+	return id != "" && id != "." && id != ".." && filepath.Base(id) == id && !strings.ContainsAny(id, `/\`)
+}
+
+// collectArtifacts indexes the regular files in the artifacts folder of a
+// run. Symlinks and other special files are ignored, and the folder is
+// removed when the run left nothing in it.
+func collectArtifacts(historyID string) ([]*Artifact, error) {
+	dir := artifactsDir(historyID)
+	var artifacts []*Artifact
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		artifact, err := indexArtifact(dir, path)
+		if err != nil {
+			return err
+		}
+		artifact.HistoryID = historyID
+		artifacts = append(artifacts, artifact)
+		return nil
+	})
+	if len(artifacts) == 0 {
+		os.RemoveAll(dir)
+	}
+	return artifacts, err
+}
+
+func indexArtifact(dir, path string) (*Artifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	hash.Write(head[:n])
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, err
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(head[:n])
+	}
+	rel, _ := filepath.Rel(dir, path)
+	return &Artifact{
+		ID:        uuid.New().String(),
+		Name:      filepath.ToSlash(rel),
+		Size:      info.Size(),
+		MimeType:  mimeType,
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		CreatedAt: info.ModTime(),
+	}, nil
+}
+
+func listArtifactsHandler(c *gin.Context) {
+	artifacts, err := storage.ListArtifacts(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if artifacts == nil {
+		artifacts = []*Artifact{}
+	}
+	c.JSON(http.StatusOK, artifacts)
+}
+
+// downloadArtifactHandler serves an artifact as an attachment, or inline
+// with ?inline=true so images and reports open in the browser. Responses
+// are sandboxed by CSP, so inline HTML cannot act on the API's origin.
+func downloadArtifactHandler(c *gin.Context) {
+	artifact, err := storage.GetArtifact(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+		return
+	}
+	dir := artifactsDir(artifact.HistoryID)
+	path := filepath.Join(dir, filepath.FromSlash(artifact.Name))
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		c.JSON(http.StatusGone, gin.H{"error": "artifact file is missing"})
+		return
+	}
+	c.Header("Content-Type", artifact.MimeType)
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("X-Content-Type-Options", "nosniff")
+	if c.Query("inline") == "true" {
+		c.File(path)
+		return
+	}
+	c.FileAttachment(path, filepath.Base(path))
+}
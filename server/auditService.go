@@ -0,0 +1,105 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AuditEntry records an accepted or rejected attempt to run a script.
+type AuditEntry struct {
+	ID         string    `json:"id"`
+	ScriptID   string    `json:"script_id"`
+	ScriptName string    `json:"script_name"`
+	HistoryID  string    `json:"history_id,omitempty"`
+	Action     string    `json:"action"`
+	Outcome    string    `json:"outcome"` // accepted or rejected
+	Reason     string    `json:"reason,omitempty"`
+	Actor      string    `json:"actor"`
+	ClientIP   string    `json:"client_ip"`
+	Profile    string    `json:"profile,omitempty"`
+	Danger     string    `json:"danger,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const (
+	auditAccepted = "accepted"
+	auditRejected = "rejected"
+)
+
+// Danger levels accepted by the @danger metadata key, in increasing order.
+var dangerLevels = []string{"low", "medium", "high", "critical"}
+
+// requiredConfirmation returns the token a caller must echo back in
+// ExecuteRequest.Confirm to run the script, or "" when no confirmation is needed.
+// "@confirm: true" and danger levels of high or above require the script name;
+// any other @confirm value is the phrase itself. An unrecognised danger level
+// is treated as critical so a typo never disables the gate.
+func requiredConfirmation(script *Script) string {
+	phrase := strings.TrimSpace(script.Confirm)
+	switch strings.ToLower(phrase) {
+	case "", "false", "no":
+		danger := strings.ToLower(strings.TrimSpace(script.Danger))
+		if danger == "high" || danger == "critical" || (danger != "" && !containsString(dangerLevels, danger)) {
+			return script.Name
+		}
+		return ""
+	case "true", "yes":
+		return script.Name
+	}
+	return phrase
+}
+
+// auditActor identifies who triggered a request: the X-Dev-Loop-User header
+// when the client provides one, otherwise the client IP. The header is
+// self-reported, so audit entries also keep the client IP separately.
+func auditActor(c *gin.Context) string {
+	if user := strings.TrimSpace(c.GetHeader("X-Dev-Loop-User")); user != "" {
+		return user
+	}
+	return c.ClientIP()
+}
+
+func recordAudit(c *gin.Context, script *Script, historyID, profile, outcome, reason string) {
+	entry := &AuditEntry{
+		ID:         uuid.New().String(),
+		ScriptID:   script.ID,
+		ScriptName: script.Name,
+		HistoryID:  historyID,
+		Action:     "exec",
+		Outcome:    outcome,
+		Reason:     reason,
+		Actor:      auditActor(c),
+		ClientIP:   c.ClientIP(),
+		Profile:    profile,
+		Danger:     script.Danger,
+		CreatedAt:  time.Now(),
+	}
+	log.Printf("audit: %s %s script=%s actor=%s ip=%s profile=%s reason=%s", entry.Action, outcome, script.ID, entry.Actor, entry.ClientIP, profile, reason)
+	if err := storage.SaveAuditEntry(entry); err != nil {
+		log.Printf("audit: failed to save entry: %v", err)
+	}
+}
+
+func listAuditHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+	entries, err := storage.ListAuditEntries(c.Query("scriptId"), offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if entries == nil {
+		entries = []*AuditEntry{}
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// errCompile marks a failed compile step, as opposed to a failure to run it.
+var errCompile = errors.New("compile failed")
+
+// buildLocks serializes builds of the same script by concurrent runs, which
+// would otherwise remove each other's build folders.
+var buildLocks sync.Map
+
+// buildCacheDir returns the folder holding the cached builds of a script.
+func buildCacheDir(l Language, script *Script) string {
+	return filepath.Join(getConfigFolderPath(), "cache", l.Name, script.ID)
+}
+
+// buildEnvVars are the variables of the run's environment that change what a
+// compile step produces.
+var buildEnvVars = []string{
+	"GOFLAGS", "GOOS", "GOARCH", "GOAMD64", "GOARM", "GOEXPERIMENT", "GOTOOLCHAIN",
+	"GOPRIVATE", "GOPROXY", "CGO_ENABLED", "CGO_CFLAGS", "CGO_LDFLAGS", "CC",
+}
+
+// buildKey hashes everything a build depends on: the script, the compile
+// command, the toolchain version and target platform, the build variables of
+// the run's environment, and for Go the module files next to the script.
+func buildKey(l Language, script *Script, environ []string) (string, error) {
+	content, err := os.ReadFile(script.Path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(content)
+	fmt.Fprintf(h, "\x00%s\x00%s/%s\x00", l.Compile, runtime.GOOS, runtime.GOARCH)
+	for _, name := range buildEnvVars {
+		fmt.Fprintf(h, "%s=%s\x00", name, lookupEnv(environ, name))
+	}
+	if l.Version != "" {
+		out, err := toolchainVersion(l.Version, lookupEnv(environ, "PATH"))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", l.Version, err)
+		}
+		h.Write([]byte(out))
+	}
+	for _, name := range []string{"go.mod", "go.sum"} {
+		if data, err := os.ReadFile(filepath.Join(filepath.Dir(script.Path), name)); err == nil {
+			h.Write(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+var toolchainVersions sync.Map // binary path and arguments -> probedVersion
+
+// toolchainVersion returns the output of a language's version command found
+// on the given PATH, cached by the binary's path and modification time like
+// toolVersionAt.
+func toolchainVersion(command, pathList string) (string, error) {
+	fields := strings.Fields(command)
+	path, err := lookPathIn(fields[0], pathList)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key := path + "\x00" + strings.Join(fields[1:], "\x00")
+	if cached, ok := toolchainVersions.Load(key); ok && cached.(probedVersion).modTime.Equal(info.ModTime()) {
+		return cached.(probedVersion).version, cached.(probedVersion).err
+	}
+	out, err := exec.Command(path, fields[1:]...).Output()
+	toolchainVersions.Store(key, probedVersion{modTime: info.ModTime(), version: string(out), err: err})
+	return string(out), err
+}
+
+// buildScript returns the binary for a script of a compiled language, building
+// it with the language's compile step on a cache miss. Builds are cached under
+// ~/.dev-loop/cache/<language>/<script id>/<key> and older builds of the same
+// script are removed once a new one succeeds. Concurrent runs of a script wait
+// for its build rather than compiling it twice. The compiler runs with the
+// run's environment. Its output is returned on failure, with an error wrapping
+// errCompile when the compiler itself failed.
+func buildScript(l Language, script *Script, environ []string) (binary string, output string, exitCode int, err error) {
+	key, err := buildKey(l, script, environ)
+	if err != nil {
+		return "", "", -1, err
+	}
+	name := strings.TrimSuffix(filepath.Base(script.Path), filepath.Ext(script.Path))
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	dir := buildCacheDir(l, script)
+	binary = filepath.Join(dir, key, name)
+	if _, err := os.Stat(binary); err == nil {
+		return binary, "", 0, nil
+	}
+
+	lock, _ := buildLocks.LoadOrStore(dir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	// Another run may have built it while this one waited
+	if _, err := os.Stat(binary); err == nil {
+		return binary, "", 0, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", -1, err
+	}
+	tmp, err := os.MkdirTemp(dir, ".build-")
+	if err != nil {
+		return "", "", -1, err
+	}
+	defer os.RemoveAll(tmp)
+	out := filepath.Join(tmp, name)
+	var argv []string
+	for _, field := range strings.Fields(l.Compile) {
+		field = strings.ReplaceAll(field, "{src}", script.Path)
+		argv = append(argv, strings.ReplaceAll(field, "{out}", out))
+	}
+	if len(argv) == 0 {
+		return "", "", -1, fmt.Errorf("language %s has an empty compile command", l.Name)
+	}
+	compiler, err := lookPathIn(argv[0], lookupEnv(environ, "PATH"))
+	if err != nil {
+		return "", "", -1, err
+	}
+	cmd := exec.Command(compiler, argv[1:]...)
+	cmd.Dir = filepath.Dir(script.Path)
+	cmd.Env = environ
+	combined, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", string(combined), exitErr.ExitCode(), fmt.Errorf("%w: %s exited with code %d", errCompile, argv[0], exitErr.ExitCode())
+		}
+		return "", string(combined), -1, err
+	}
+
+	// Drop builds of previous versions of the script before publishing this one
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.Name() != filepath.Base(tmp) && entry.Name() != key {
+			os.RemoveAll(filepath.Join(dir, entry.Name()))
+		}
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, key)); err != nil {
+		// Another dev-loop process may have published the same build first
+		if _, statErr := os.Stat(binary); statErr != nil {
+			return "", string(combined), -1, err
+		}
+	}
+	return binary, string(combined), 0, nil
+}
+
+// lookupEnv returns the value of a variable in an environment list; like the
+// process environment, the last entry wins.
+func lookupEnv(environ []string, name string) string {
+	for i := len(environ) - 1; i >= 0; i-- {
+		if value, ok := strings.CutPrefix(environ[i], name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
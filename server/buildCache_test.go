@@ -0,0 +1,33 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("package main\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := Language{Name: "go", Compile: "go build -o {out} {src}"}
+	script := &Script{ID: "main", Path: path}
+	key := func(environ ...string) string {
+		k, err := buildKey(l, script, environ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	base := key("HOME=/home/a", "GOFLAGS=")
+	if got := key("HOME=/home/b"); got != base {
+		t.Errorf("unrelated variable changed the key: %s != %s", got, base)
+	}
+	if got := key("GOFLAGS=-tags=x"); got == base {
+		t.Error("GOFLAGS did not change the key")
+	}
+	if got := key("CGO_ENABLED=1", "CGO_ENABLED=0"); got != key("CGO_ENABLED=0") {
+		t.Error("the last value of a repeated variable should win")
+	}
+}
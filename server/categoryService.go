@@ -19,3 +19,16 @@ func listCategoriesHandler(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, counts)
 }
+
+func listTagsHandler(c *gin.Context) {
+	counts, err := storage.(*SQLiteStorage).ListTagCounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+
+	if counts == nil {
+		counts = []TagCount{}
+	}
+	c.JSON(http.StatusOK, counts)
+}
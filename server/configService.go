@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -10,11 +11,47 @@ import (
 )
 
 type Config struct {
-	ScriptFolders        []string          `json:"scriptFolders"`
-	ExtensionCommands    map[string]string `json:"extensionCommands"`
-	EnvironmentVariables map[string]string `json:"environmentVariables,omitempty"`
-	APIKey               string            `json:"apiKey,omitempty"`
-	Editor               string            `json:"editor,omitempty"`
+	ScriptFolders        []string           `json:"scriptFolders"`
+	ExtensionCommands    map[string]string  `json:"extensionCommands"`   // interpreter overrides by extension
+	Languages            []Language         `json:"languages,omitempty"` // added to, or replacing, builtinLanguages by name
+	EnvironmentVariables map[string]string  `json:"environmentVariables,omitempty"`
+	APIKey               string             `json:"apiKey,omitempty"`
+	Editor               string             `json:"editor,omitempty"`
+	Profiles             map[string]Profile `json:"profiles,omitempty"`
+	DefaultProfile       string             `json:"defaultProfile,omitempty"`
+	SearchScriptContent  bool               `json:"searchScriptContent,omitempty"` // index file content for full-text search
+	DisableWatch         bool               `json:"disableWatch,omitempty"`        // stop reloading scripts when files change
+	// IgnorePatterns are gitignore-style patterns applied to every script folder, on top of
+	// .devloopignore files. Null uses defaultIgnorePatterns; an empty list ignores nothing.
+	IgnorePatterns  []string                  `json:"ignorePatterns"`
+	RequireMetadata bool                      `json:"requireMetadata,omitempty"` // only register files with an @name: line
+	FolderSettings  map[string]FolderSettings `json:"folderSettings,omitempty"`  // keyed by script folder
+	PackageIndex    PackageIndex              `json:"packageIndex,omitempty"`    // mirrors used when installing @requirements and @dependencies
+	TaskProviders   []string                  `json:"taskProviders,omitempty"`   // register package.json scripts ("npm"), Makefile targets ("make") and justfile recipes ("just")
+	Output          OutputLimits              `json:"output,omitempty"`          // caps and spooling of run output
+}
+
+// FolderSettings tunes discovery for a single script folder.
+type FolderSettings struct {
+	MaxDepth int `json:"maxDepth,omitempty"` // 1 registers only files directly in the folder, 0 is unlimited
+}
+
+func (c *Config) ignorePatterns() []string {
+	if c.IgnorePatterns == nil {
+		return defaultIgnorePatterns
+	}
+	return c.IgnorePatterns
+}
+
+// folderSettings returns the settings for a folder, keyed either as written
+// in the config or by its expanded path.
+func (c *Config) folderSettings(folder string) FolderSettings {
+	for key, settings := range c.FolderSettings {
+		if key == folder || expandHome(key) == folder {
+			return settings
+		}
+	}
+	return FolderSettings{}
 }
 
 var configCache *Config
@@ -64,6 +101,12 @@ func LoadConfig() (*Config, error) {
 	if config.Editor == "" {
 		config.Editor = "code"
 	}
+	// Configs written by earlier versions ran Go scripts with "go run";
+	// leave them to the cached build step unless the user changed the entry
+	if config.ExtensionCommands[".go"] == "go run" {
+		delete(config.ExtensionCommands, ".go")
+		log.Printf("config: using the Go build cache instead of extensionCommands \".go\": \"go run\"")
+	}
 
 	configCache = config
 	return config, nil
@@ -84,18 +127,10 @@ func SaveConfig(config *Config) error {
 
 func defaultConfig() *Config {
 	return &Config{
-		ScriptFolders: []string{"~/.dev-loop/scripts"},
-		ExtensionCommands: map[string]string{
-			".py":   "python",
-			".js":   "node",
-			".ts":   "ts-node",
-			".go":   "go run",
-			".sh":   "bash",
-			".bash": "bash",
-			".zsh":  "zsh",
-			".zx":   "zx",
-		},
+		ScriptFolders:        []string{"~/.dev-loop/scripts"},
+		ExtensionCommands:    make(map[string]string), // the built-in languages cover the common extensions
 		EnvironmentVariables: make(map[string]string),
+		IgnorePatterns:       defaultIgnorePatterns,
 		APIKey:               "",
 		Editor:               "code",
 	}
@@ -120,5 +155,12 @@ func updateConfigHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save config"})
 		return
 	}
+	watchScriptFolders(&cfg)
+	// Discovery settings may have changed, so re-scan every file
+	go func() {
+		if report, err := reloadScripts(nil, true); err == nil && report.changed() {
+			events.publish("scripts.changed", report)
+		}
+	}()
 	c.JSON(http.StatusOK, cfg)
 }
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServerEvent is pushed to clients connected to the event stream.
+type ServerEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+	Time time.Time   `json:"time"`
+}
+
+// eventHub fans events out to every connected client.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan ServerEvent]struct{}
+}
+
+var events = &eventHub{subscribers: make(map[chan ServerEvent]struct{})}
+
+func (h *eventHub) subscribe() chan ServerEvent {
+	ch := make(chan ServerEvent, 16)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan ServerEvent) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+}
+
+// publish sends an event to every subscriber, dropping it for clients that
+// are not keeping up rather than blocking the publisher.
+func (h *eventHub) publish(eventType string, data interface{}) {
+	event := ServerEvent{Type: eventType, Data: data, Time: time.Now()}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// eventsHandler streams server events to the client as server-sent events.
+func eventsHandler(c *gin.Context) {
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", ServerEvent{Type: "ready", Time: time.Now()})
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-ch:
+			c.SSEvent(event.Type, event)
+			return true
+		case <-ping.C:
+			c.SSEvent("ping", ServerEvent{Type: "ping", Time: time.Now()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// envVar is a variable set on a run on top of the server's own environment.
+type envVar struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"` // request, config, profile:<name>, secret:<ref> or dev-loop
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// execution is a resolved run of a script: its command line, working
+// directory and environment, before any build or dependency setup happens.
+type execution struct {
+	lang       Language // compile step, if any
+	argv       []string // program followed by its arguments
+	scriptArg  int      // index of the script path in argv, replaced by the build output; -1 for tasks
+	dir        string
+	env        []envVar          // in the order they are applied, later entries win
+	runtimeEnv map[string]string // set up by dependency environments, kept out of history
+}
+
+// resolveExecution works out how a request runs a script. It merges the
+// config and profile variables into req.Env, as recorded in history, and sets
+// req.Command to the command line used. It does not start any process.
+func resolveExecution(cfg *Config, script *Script, req *ExecuteRequest, profileName string, profile *Profile, secretEnv map[string]string) (*execution, error) {
+	e := &execution{scriptArg: -1, runtimeEnv: map[string]string{}}
+
+	// Add environment variables from config, then from the selected profile
+	if req.Env == nil {
+		req.Env = make(map[string]string)
+	}
+	sources := make(map[string]string, len(req.Env))
+	for k := range req.Env {
+		sources[k] = "request"
+	}
+	for k, v := range cfg.EnvironmentVariables {
+		req.Env[k], sources[k] = v, "config"
+	}
+	if profile != nil {
+		for k, v := range profile.Variables {
+			req.Env[k], sources[k] = v, "profile:"+profileName
+		}
+	}
+	for k, v := range req.Env {
+		e.env = append(e.env, envVar{Name: k, Value: v, Source: sources[k]})
+	}
+	if profile != nil {
+		for k, ref := range profile.Secrets {
+			e.env = append(e.env, envVar{Name: k, Value: secretEnv[k], Source: "secret:" + ref, Secret: true})
+		}
+	}
+	// Secrets still follow variables of the same name after sorting
+	sort.SliceStable(e.env, func(i, j int) bool { return e.env[i].Name < e.env[j].Name })
+
+	if script.Task != "" {
+		// Project tasks run through their tool from the project directory
+		argv, err := taskCommand(script, req.Args)
+		if err != nil {
+			return nil, err
+		}
+		e.argv, e.dir = argv, filepath.Dir(script.Path)
+		req.Command = strings.Join(argv, " ")
+		return e, nil
+	}
+
+	if req.Command == "" {
+		lang, known := cfg.languageFor(script.Path)
+		if script.Runner == runnerShebang || !known {
+			// Execute the file itself, or its #! interpreter when it is not executable
+			command, err := directCommand(script)
+			if err != nil {
+				return nil, err
+			}
+			lang = Language{Interpreter: command}
+		}
+		e.lang = lang
+		req.Command = lang.Interpreter
+	}
+
+	// Split the command into parts if it contains spaces; without an
+	// interpreter the script (or its compiled binary) is executed directly
+	e.argv = strings.Fields(req.Command)
+	e.scriptArg = len(e.argv)
+	e.argv = append(append(e.argv, script.Path), req.Args...)
+	return e, nil
+}
+
+// setEnv sets a variable provided by dev-loop itself, such as DEVLOOP_RESULT.
+func (e *execution) setEnv(name, value string) {
+	e.env = append(e.env, envVar{Name: name, Value: value, Source: "dev-loop"})
+}
+
+// getenv returns the value a variable will have in the run's environment.
+func (e *execution) getenv(name string) string {
+	if v, ok := e.runtimeEnv[name]; ok {
+		return v
+	}
+	for i := len(e.env) - 1; i >= 0; i-- {
+		if e.env[i].Name == name {
+			return e.env[i].Value
+		}
+	}
+	return os.Getenv(name)
+}
+
+// environ returns the process environment of the run.
+func (e *execution) environ() []string {
+	env := os.Environ()
+	for _, v := range e.env {
+		env = append(env, v.Name+"="+v.Value)
+	}
+	for k, v := range e.runtimeEnv {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// ExecutionStep describes work done before the script starts.
+type ExecutionStep struct {
+	Phase       string   `json:"phase"` // compile or setup
+	Description string   `json:"description"`
+	Command     string   `json:"command,omitempty"`
+	Packages    []string `json:"packages,omitempty"`
+}
+
+// dryRun describes the resolved execution without running anything. Secret
+// values are masked, and work that needs the toolchain, such as building or
+// installing dependencies, is listed as steps rather than performed.
+func (e *execution) dryRun(cfg *Config, script *Script, req *ExecuteRequest) gin.H {
+	argv := append([]string{}, e.argv...)
+	var steps []ExecutionStep
+	if e.lang.Compile != "" && e.scriptArg >= 0 {
+		name := strings.TrimSuffix(filepath.Base(script.Path), filepath.Ext(script.Path))
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+		argv[e.scriptArg] = filepath.Join(buildCacheDir(e.lang, script), "<build key>", name)
+		steps = append(steps, ExecutionStep{
+			Phase:       phaseCompile,
+			Description: fmt.Sprintf("build with %s unless a cached build of this version exists", e.lang.Name),
+			Command:     e.lang.Compile,
+		})
+	}
+	if len(script.Requirements) > 0 {
+		steps = append(steps, ExecutionStep{Phase: phaseSetup, Description: "create or reuse a Python virtualenv under ~/.dev-loop/envs/python and run the script with its interpreter", Packages: script.Requirements})
+	}
+	if len(script.Dependencies) > 0 {
+		steps = append(steps, ExecutionStep{Phase: phaseSetup, Description: "create or reuse node_modules under ~/.dev-loop/envs/node and set NODE_PATH", Packages: script.Dependencies})
+	}
+	if steps == nil {
+		steps = []ExecutionStep{}
+	}
+
+	env := make([]envVar, 0, len(e.env))
+	for _, v := range e.env {
+		if v.Secret {
+			v.Value = "*****"
+		}
+		env = append(env, v)
+	}
+	env = append(env,
+		envVar{Name: resultEnv, Value: filepath.Join(os.TempDir(), "devloop-result-*.json"), Source: "dev-loop"},
+		envVar{Name: artifactsEnv, Value: artifactsDir("<history id>"), Source: "dev-loop"})
+	dir := e.dir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	program := ""
+	if len(argv) > 0 {
+		program = argv[0]
+	}
+	return gin.H{
+		"dryRun":              true,
+		"script":              gin.H{"id": script.ID, "name": script.Name, "path": script.Path},
+		"profile":             req.Profile,
+		"interpreter":         program,
+		"argv":                argv,
+		"dir":                 dir,
+		"env":                 env,
+		"inheritsEnvironment": true, // the server's environment is passed on below these variables
+		"stdin":               req.Stdin,
+		"stdinOpen":           req.StdinOpen,
+		"tty":                 script.TTY || req.TTY,
+		"steps":               steps,
+		"limits": gin.H{
+			"repeat":    req.Repeat,
+			"retry":     req.Retry,
+			"backoffMs": req.Backoff,
+			"timeout":   nil, // runs are not time limited
+		},
+		"confirmation": gin.H{"required": requiredConfirmation(script) != "", "satisfied": requiredConfirmation(script) == req.Confirm},
+		"readiness":    script.Readiness,
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// flagValue returns the new value of a favorite or pinned flag: PUT sets it,
+// DELETE clears it and POST toggles it. PUT and DELETE are idempotent, so
+// repeated clicks settle on the state the client asked for.
+func flagValue(c *gin.Context, current bool) bool {
+	switch c.Request.Method {
+	case http.MethodPut:
+		return true
+	case http.MethodDelete:
+		return false
+	}
+	return !current
+}
+
+func favoriteHandler(c *gin.Context) {
+	id := c.Param("id")
+	script, err := storage.GetScript(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "script not found"})
+		return
+	}
+	script.Favorite = flagValue(c, script.Favorite)
+	if err := storage.SetFavorite(id, script.Favorite); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "favorite": script.Favorite, "pinned": script.Pinned})
+}
+
+func pinHandler(c *gin.Context) {
+	id := c.Param("id")
+	script, err := storage.GetScript(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "script not found"})
+		return
+	}
+	script.Pinned = flagValue(c, script.Pinned)
+	if err := storage.SetPinned(id, script.Pinned); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "favorite": script.Favorite, "pinned": script.Pinned})
+}
+
+// listFavoritesHandler returns favorite and pinned scripts, pinned first.
+func listFavoritesHandler(c *gin.Context) {
+	scripts, err := storage.ListScripts(ScriptQuery{FavoritesOnly: true, Limit: -1})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if scripts == nil {
+		scripts = []*Script{}
+	}
+	c.JSON(http.StatusOK, scripts)
+}
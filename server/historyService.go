@@ -1,23 +1,184 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ExecutionHistory struct {
-	ID             string         `json:"id"`
-	ScriptID       string         `json:"script_id"`
-	ExecutedAt     time.Time      `json:"executed_at"`
-	FinishedAt     time.Time      `json:"finished_at"`
-	ExecuteRequest ExecuteRequest `json:"execute_request"`
-	Output         string         `json:"output"`
-	ExitCode       int            `json:"exitcode"`
-	Incognito      bool           `json:"incognito"`
-	Command        string         `json:"command"`
+	ID             string          `json:"id"`
+	ScriptID       string          `json:"script_id"`
+	ExecutedAt     time.Time       `json:"executed_at"`
+	FinishedAt     time.Time       `json:"finished_at"`
+	ExecuteRequest ExecuteRequest  `json:"execute_request"`
+	Output         string          `json:"output"`
+	ExitCode       int             `json:"exitcode"`
+	Incognito      bool            `json:"incognito"`
+	Command        string          `json:"command"`
+	Phase          string          `json:"phase,omitempty"`       // step that failed before the script ran, e.g. "compile"
+	Setup          string          `json:"setup,omitempty"`       // log of preparing the script's dependency environment
+	Result         json.RawMessage `json:"result,omitempty"`      // JSON the script wrote to DEVLOOP_RESULT
+	ResultError    string          `json:"resultError,omitempty"` // why the result is invalid or does not match @output-schema
+	Artifacts      []*Artifact     `json:"artifacts,omitempty"`   // set by getHistoryByIDHandler
+	// Output past config output.spoolBytes is kept in LogFile, with only its
+	// head and tail in Output; read it with ?offset=&limit= on /api/history/:id.
+	LogFile       string       `json:"logFile,omitempty"`
+	OutputSize    int64        `json:"outputSize"`              // bytes of output kept
+	OutputDropped int64        `json:"outputDropped,omitempty"` // bytes past config output.maxBytes
+	Range         *OutputRange `json:"range,omitempty"`         // set for ranged reads
+}
+
+// Phases of a run that can fail before the script itself starts.
+const (
+	phaseSetup    = "setup"    // installing @requirements or @dependencies
+	phaseCompile  = "compile"  // building a compiled language
+	phaseRequires = "requires" // checking @requires against the run's PATH
+)
+
+// HistorySearch filters a global history search. Zero values are ignored.
+// Query matches the stored output (the head and tail for spooled runs), the
+// command and the arguments, never the environment or stdin.
+type HistorySearch struct {
+	Query       string
+	ScriptID    string
+	Phase       string // failure phase such as "compile"
+	ExitCode    *int
+	From        time.Time
+	To          time.Time
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	Offset      int
+	Limit       int
+}
+
+// HistoryExcerpt is an output line matching a history search.
+type HistoryExcerpt struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+type HistorySearchResult struct {
+	*ExecutionHistory
+	Excerpts []HistoryExcerpt `json:"excerpts"`
+}
+
+const (
+	maxHistoryExcerpts     = 5
+	maxHistoryExcerptChars = 240
+)
+
+// historyExcerpts returns the output lines matching the query the way the
+// search does: a token of the line starts with one of the query terms, or,
+// for searches without the FTS index, the line contains the whole query.
+func historyExcerpts(output, query string) []HistoryExcerpt {
+	excerpts := []HistoryExcerpt{}
+	query = strings.ToLower(query)
+	terms := ftsTerms(query)
+	if len(terms) == 0 && strings.TrimSpace(query) == "" {
+		return excerpts
+	}
+	for i, line := range strings.Split(output, "\n") {
+		if !excerptMatches(strings.ToLower(line), query, terms) {
+			continue
+		}
+		if runes := []rune(line); len(runes) > maxHistoryExcerptChars {
+			line = string(runes[:maxHistoryExcerptChars]) + "…"
+		}
+		excerpts = append(excerpts, HistoryExcerpt{Line: i + 1, Text: line})
+		if len(excerpts) >= maxHistoryExcerpts {
+			break
+		}
+	}
+	return excerpts
+}
+
+func excerptMatches(line, query string, terms []string) bool {
+	if strings.Contains(line, query) {
+		return true
+	}
+	for _, token := range ftsTerms(line) {
+		for _, term := range terms {
+			if strings.HasPrefix(token, term) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseHistoryTime accepts RFC 3339 timestamps or plain YYYY-MM-DD dates.
+func parseHistoryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func searchHistoryHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	search := HistorySearch{
+		Query:    strings.TrimSpace(c.Query("q")),
+		ScriptID: c.Query("scriptId"),
+		Phase:    c.Query("phase"),
+		Offset:   (page - 1) * limit,
+		Limit:    limit,
+	}
+	if v := c.Query("exitCode"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exitCode"})
+			return
+		}
+		search.ExitCode = &code
+	}
+	for param, dest := range map[string]*time.Time{"from": &search.From, "to": &search.To} {
+		if v := c.Query(param); v != "" {
+			t, err := parseHistoryTime(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+				return
+			}
+			*dest = t
+		}
+	}
+	// A date-only upper bound includes the whole day
+	if v := c.Query("to"); len(v) == len("2006-01-02") {
+		search.To = search.To.Add(24*time.Hour - time.Nanosecond)
+	}
+	for param, dest := range map[string]*time.Duration{"minDuration": &search.MinDuration, "maxDuration": &search.MaxDuration} {
+		if v := c.Query(param); v != "" {
+			ms, err := strconv.Atoi(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ", expected milliseconds"})
+				return
+			}
+			*dest = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	histories, total, err := storage.SearchExecutionHistory(search)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	results := make([]HistorySearchResult, 0, len(histories))
+	for _, h := range histories {
+		excerpts := historyExcerpts(renderOutput(h.Output, formatPlain), search.Query)
+		h.Output = "" // full output is available from /api/history/:id
+		results = append(results, HistorySearchResult{ExecutionHistory: h, Excerpts: excerpts})
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results, "total": total, "page": page, "limit": limit})
 }
 
 func listScriptHistoryHandler(c *gin.Context) {
@@ -28,17 +189,96 @@ func listScriptHistoryHandler(c *gin.Context) {
 		page = 1
 	}
 	offset := (page - 1) * limit
+	format := c.Query("format")
+	if err := checkOutputFormat(format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	history, _ := storage.ListExecutionHistory(id, offset, limit)
+	for _, h := range history {
+		formatHistoryOutput(h, format)
+	}
 	c.JSON(http.StatusOK, history)
 }
 
+// formatHistoryOutput renders the output of a history entry in format,
+// which defaults to ansi so overwritten progress lines are collapsed.
+func formatHistoryOutput(h *ExecutionHistory, format string) {
+	if format == "" {
+		format = formatANSI
+	}
+	if !h.Incognito {
+		h.Output = renderOutput(h.Output, format)
+	}
+}
+
+// Default and largest page sizes of ranged output reads, by unit.
+var (
+	defaultRangeLimits = map[string]int64{rangeLines: 1000, rangeBytes: 1 << 20}
+	maxRangeLimits     = map[string]int64{rangeLines: 100000, rangeBytes: 4 << 20}
+)
+
+// parseOutputRange reads ?offset=&limit=&unit=lines|bytes, returning nil
+// when neither offset nor limit is given.
+func parseOutputRange(c *gin.Context) (*OutputRange, error) {
+	offset, limit := c.Query("offset"), c.Query("limit")
+	if offset == "" && limit == "" {
+		return nil, nil
+	}
+	r := &OutputRange{Unit: c.DefaultQuery("unit", rangeLines)}
+	if _, ok := defaultRangeLimits[r.Unit]; !ok {
+		return nil, fmt.Errorf("invalid unit, expected %s or %s", rangeLines, rangeBytes)
+	}
+	r.Limit = defaultRangeLimits[r.Unit]
+	var err error
+	if offset != "" {
+		if r.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil || r.Offset < 0 {
+			return nil, fmt.Errorf("invalid offset")
+		}
+	}
+	if limit != "" {
+		if r.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil || r.Limit <= 0 {
+			return nil, fmt.Errorf("invalid limit")
+		}
+	}
+	r.Limit = min(r.Limit, maxRangeLimits[r.Unit])
+	return r, nil
+}
+
+// getHistoryByIDHandler returns a history entry. With ?offset= or ?limit=
+// its output is replaced by that range of lines (or bytes with
+// ?unit=bytes), read from the full log file when the output was spooled.
 func getHistoryByIDHandler(c *gin.Context) {
 	id := c.Param("id")
+	format := c.Query("format")
+	if err := checkOutputFormat(format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	outputRange, err := parseOutputRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	history, err := storage.GetHistoryByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
+	if outputRange != nil && !history.Incognito {
+		output, err := readOutputRange(history, outputRange)
+		if errors.Is(err, errRangeUnavailable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read output: " + err.Error()})
+			return
+		}
+		history.Output, history.Range = output, outputRange
+	}
+	formatHistoryOutput(history, format)
+	history.Artifacts, _ = storage.ListArtifacts(id)
 	c.JSON(http.StatusOK, history)
 }
 
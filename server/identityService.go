@@ -0,0 +1,191 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ScriptIdentity is the stored identity and file state of a script, compared across reloads.
+type ScriptIdentity struct {
+	ID          string
+	Name        string
+	Path        string
+	Fingerprint string
+	Size        int64
+	ModTime     int64 // unix nanoseconds
+	// ParserVersion is the scriptParserVersion the row was stored with.
+	ParserVersion int
+}
+
+// IdentityMigration records a script whose ID changed and the history re-attached to it.
+type IdentityMigration struct {
+	ID          string    `json:"id"`
+	OldID       string    `json:"old_id"`
+	NewID       string    `json:"new_id"`
+	OldPath     string    `json:"old_path"`
+	NewPath     string    `json:"new_path"`
+	Reason      string    `json:"reason"` // "id changed" or "moved"
+	HistoryRows int64     `json:"history_rows"`
+	MigratedAt  time.Time `json:"migrated_at"`
+}
+
+// contentFingerprint identifies a script by its content, so a file that is
+// moved or renamed without edits can be recognised.
+func contentFingerprint(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+// relinkScripts compares the identities stored before a reload with the
+// scripts live after it, and returns the migrations needed for scripts whose
+// ID changed: either the same path now declares a different @id, or a file
+// vanished and a new one with identical content appeared elsewhere.
+func relinkScripts(previous, current []ScriptIdentity) []IdentityMigration {
+	currentIDs := make(map[string]struct{}, len(current))
+	currentPaths := make(map[string]int, len(current))
+	for _, identity := range current {
+		currentIDs[identity.ID] = struct{}{}
+		currentPaths[identity.Path]++
+	}
+	knownIDs := make(map[string]struct{}, len(previous))
+	byPath := make(map[string]ScriptIdentity, len(previous))
+	previousPaths := make(map[string]int, len(previous))
+	byFingerprint := make(map[string][]ScriptIdentity)
+	for _, identity := range previous {
+		knownIDs[identity.ID] = struct{}{}
+		byPath[identity.Path] = identity
+		previousPaths[identity.Path]++
+		if identity.Fingerprint != "" {
+			byFingerprint[identity.Fingerprint] = append(byFingerprint[identity.Fingerprint], identity)
+		}
+	}
+
+	migrations := []IdentityMigration{}
+	relinked := make(map[string]struct{})
+	orphaned := func(identity ScriptIdentity) bool {
+		_, live := currentIDs[identity.ID]
+		_, done := relinked[identity.ID]
+		return !live && !done
+	}
+	for _, script := range current {
+		if _, ok := knownIDs[script.ID]; ok {
+			continue
+		}
+		var (
+			old    ScriptIdentity
+			reason string
+		)
+		// A changed @id is only inferred for files holding a single script, not
+		// for project files whose targets come and go
+		if identity, ok := byPath[script.Path]; ok && orphaned(identity) && previousPaths[script.Path] == 1 && currentPaths[script.Path] == 1 {
+			old, reason = identity, "id changed"
+		} else {
+			for _, identity := range byFingerprint[script.Fingerprint] {
+				if _, stillThere := currentPaths[identity.Path]; !stillThere && orphaned(identity) {
+					old, reason = identity, "moved"
+					break
+				}
+			}
+		}
+		if reason == "" {
+			continue
+		}
+		relinked[old.ID] = struct{}{}
+		migrations = append(migrations, IdentityMigration{
+			ID:         uuid.New().String(),
+			OldID:      old.ID,
+			NewID:      script.ID,
+			OldPath:    old.Path,
+			NewPath:    script.Path,
+			Reason:     reason,
+			MigratedAt: time.Now(),
+		})
+	}
+	return migrations
+}
+
+// claimScriptIDs resolves scripts re-parsed by a reload that declare an @id
+// another file already uses, which would otherwise overwrite each other's
+// row. Files that were not re-parsed keep their ids, then files that held
+// the id before; any other claimant falls back to its path-derived id with
+// an error diagnostic. current and report are updated to the new ids.
+func claimScriptIDs(previous, current []ScriptIdentity, saved []*Script, report *ReloadReport) {
+	reparsed := make(map[string]struct{}, len(saved))
+	for _, script := range saved {
+		reparsed[script.Path] = struct{}{}
+	}
+	owners := make(map[string]string)
+	for _, identity := range current {
+		if _, ok := reparsed[identity.Path]; !ok {
+			owners[identity.ID] = identity.Path
+		}
+	}
+	held := make(map[string]string, len(previous))
+	for _, identity := range previous {
+		held[identity.ID] = identity.Path
+	}
+	ordered := make([]*Script, 0, len(saved))
+	for _, script := range saved {
+		if held[script.ID] == script.Path {
+			ordered = append(ordered, script)
+		}
+	}
+	for _, script := range saved {
+		if held[script.ID] != script.Path {
+			ordered = append(ordered, script)
+		}
+	}
+
+	for _, script := range ordered {
+		owner, taken := owners[script.ID]
+		if !taken || owner == script.Path || script.idLine == 0 {
+			owners[script.ID] = script.Path
+			continue
+		}
+		oldID := script.ID
+		script.ID = md5Hash(script.Path)
+		owners[script.ID] = script.Path
+		script.Diagnostics = append(script.Diagnostics, Diagnostic{
+			Line:     script.idLine,
+			Key:      "id",
+			Message:  fmt.Sprintf("duplicate id %q, already used by %s", oldID, owner),
+			Severity: severityError,
+		})
+		for i := range current {
+			if current[i].Path == script.Path && current[i].ID == oldID {
+				current[i].ID = script.ID
+			}
+		}
+		for _, changes := range [][]ScriptChange{report.Added, report.Updated, report.Unchanged} {
+			for i := range changes {
+				if changes[i].Path == script.Path && changes[i].ID == oldID {
+					changes[i].ID = script.ID
+				}
+			}
+		}
+	}
+}
+
+func listIdentityMigrationsHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	migrations, err := storage.ListIdentityMigrations((page-1)*limit, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if migrations == nil {
+		migrations = []*IdentityMigration{}
+	}
+	c.JSON(http.StatusOK, migrations)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRelinkScripts(t *testing.T) {
+	id := func(id, path, fingerprint string) ScriptIdentity {
+		return ScriptIdentity{ID: id, Path: path, Fingerprint: fingerprint}
+	}
+	tests := []struct {
+		name     string
+		previous []ScriptIdentity
+		current  []ScriptIdentity
+		want     []string // "old -> new (reason)"
+	}{
+		{
+			name:     "unchanged",
+			previous: []ScriptIdentity{id("a", "/s/a.sh", "f1")},
+			current:  []ScriptIdentity{id("a", "/s/a.sh", "f1")},
+		},
+		{
+			name:     "moved file",
+			previous: []ScriptIdentity{id("a", "/s/a.sh", "f1")},
+			current:  []ScriptIdentity{id("b", "/s/sub/a.sh", "f1")},
+			want:     []string{"a -> b (moved)"},
+		},
+		{
+			name:     "id changed in place",
+			previous: []ScriptIdentity{id("a", "/s/a.sh", "f1")},
+			current:  []ScriptIdentity{id("deploy", "/s/a.sh", "f2")},
+			want:     []string{"a -> deploy (id changed)"},
+		},
+		{
+			name:     "copy keeps the original",
+			previous: []ScriptIdentity{id("a", "/s/a.sh", "f1")},
+			current:  []ScriptIdentity{id("a", "/s/a.sh", "f1"), id("b", "/s/b.sh", "f1")},
+		},
+		{
+			name:     "copy of a removed file is relinked once",
+			previous: []ScriptIdentity{id("a", "/s/a.sh", "f1")},
+			current:  []ScriptIdentity{id("b", "/s/b.sh", "f1"), id("c", "/s/c.sh", "f1")},
+			want:     []string{"a -> b (moved)"},
+		},
+		{
+			name:     "edited and moved is a new script",
+			previous: []ScriptIdentity{id("a", "/s/a.sh", "f1")},
+			current:  []ScriptIdentity{id("b", "/s/b.sh", "f2")},
+		},
+		{
+			name:     "project targets are not relinked by path",
+			previous: []ScriptIdentity{id("t1", "/p/Makefile", "m1"), id("t2", "/p/Makefile", "m2")},
+			current:  []ScriptIdentity{id("t1", "/p/Makefile", "m1"), id("t3", "/p/Makefile", "m3")},
+		},
+		{
+			name:     "moved project keeps its targets",
+			previous: []ScriptIdentity{id("t1", "/p/Makefile", "m1"), id("t2", "/p/Makefile", "m2")},
+			current:  []ScriptIdentity{id("u1", "/q/Makefile", "m1"), id("u2", "/q/Makefile", "m2")},
+			want:     []string{"t1 -> u1 (moved)", "t2 -> u2 (moved)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, m := range relinkScripts(tt.previous, tt.current) {
+				got = append(got, m.OldID+" -> "+m.NewID+" ("+m.Reason+")")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("relinkScripts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimScriptIDs(t *testing.T) {
+	declared := func(id, path string) *Script {
+		return &Script{ID: id, Path: path, idLine: 2}
+	}
+	tests := []struct {
+		name     string
+		previous []ScriptIdentity
+		current  []ScriptIdentity // identities of scripts not re-parsed
+		saved    []*Script
+		want     []string // ids of saved after claiming
+		errors   []string // paths with a duplicate id diagnostic
+	}{
+		{
+			name:  "distinct ids",
+			saved: []*Script{declared("a", "/s/a.sh"), declared("b", "/s/b.sh")},
+			want:  []string{"a", "b"},
+		},
+		{
+			name:    "file that was not re-parsed keeps its id",
+			current: []ScriptIdentity{{ID: "deploy", Path: "/s/old.sh"}},
+			saved:   []*Script{declared("deploy", "/s/new.sh")},
+			want:    []string{md5Hash("/s/new.sh")},
+			errors:  []string{"/s/new.sh"},
+		},
+		{
+			name:     "previous holder wins over a new claimant",
+			previous: []ScriptIdentity{{ID: "deploy", Path: "/s/b.sh"}},
+			saved:    []*Script{declared("deploy", "/s/a.sh"), declared("deploy", "/s/b.sh")},
+			want:     []string{md5Hash("/s/a.sh"), "deploy"},
+			errors:   []string{"/s/a.sh"},
+		},
+		{
+			name:   "first new claimant wins",
+			saved:  []*Script{declared("deploy", "/s/a.sh"), declared("deploy", "/s/b.sh")},
+			want:   []string{"deploy", md5Hash("/s/b.sh")},
+			errors: []string{"/s/b.sh"},
+		},
+		{
+			name:  "targets of one project file share its path",
+			saved: []*Script{{ID: "t1", Path: "/p/Makefile"}, {ID: "t2", Path: "/p/Makefile"}},
+			want:  []string{"t1", "t2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := append([]ScriptIdentity{}, tt.current...)
+			report := &ReloadReport{}
+			for _, s := range tt.saved {
+				current = append(current, ScriptIdentity{ID: s.ID, Path: s.Path})
+				report.Added = append(report.Added, ScriptChange{ID: s.ID, Path: s.Path})
+			}
+			claimScriptIDs(tt.previous, current, tt.saved, report)
+
+			var got, errs []string
+			for _, s := range tt.saved {
+				got = append(got, s.ID)
+				for _, d := range s.Diagnostics {
+					if d.Key == "id" && strings.Contains(d.Message, "duplicate id") {
+						errs = append(errs, s.Path)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ids = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(errs, tt.errors) {
+				t.Errorf("duplicate id diagnostics on %v, want %v", errs, tt.errors)
+			}
+			// current and the report follow the new ids
+			for i, s := range tt.saved {
+				identity := current[len(tt.current)+i]
+				if identity.ID != s.ID || report.Added[i].ID != s.ID {
+					t.Errorf("%s: current id %q, report id %q, want %q", s.Path, identity.ID, report.Added[i].ID, s.ID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is read from every script folder level, using gitignore syntax.
+const ignoreFileName = ".devloopignore"
+
+// defaultIgnorePatterns is used when the config does not set ignorePatterns.
+var defaultIgnorePatterns = []string{
+	".git/",
+	"node_modules/",
+	"venv/",
+	".venv/",
+	"__pycache__/",
+	"dist/",
+	"build/",
+}
+
+// ignorePattern is a single gitignore-style rule.
+type ignorePattern struct {
+	base     string // directory the pattern is relative to
+	glob     string
+	negate   bool // "!" re-includes a previously ignored path
+	dirOnly  bool // trailing "/" only matches directories
+	anchored bool // a "/" before the end matches relative to base instead of any level
+}
+
+// parseIgnorePatterns parses gitignore-style lines relative to base.
+func parseIgnorePatterns(lines []string, base string) []ignorePattern {
+	var patterns []ignorePattern
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{base: base}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // escaped leading "#" or "!"
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		p.glob = line
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+func readIgnoreFile(dir string) []ignorePattern {
+	f, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return parseIgnorePatterns(lines, dir)
+}
+
+func (p ignorePattern) matches(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(p.base, name)
+	if err != nil {
+		return false
+	}
+	// Names outside base start with a ".." segment; "..x.sh" is a real file
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+	if p.anchored {
+		return matchGlobPath(strings.Split(p.glob, "/"), strings.Split(rel, "/"))
+	}
+	ok, _ := path.Match(p.glob, path.Base(rel))
+	return ok
+}
+
+// matchGlobPath matches slash-separated segments, where a "**" segment
+// matches zero or more path segments.
+func matchGlobPath(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchGlobPath(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// ignored applies patterns in order; the last matching pattern wins.
+func ignored(patterns []ignorePattern, name string, isDir bool) bool {
+	result := false
+	for _, p := range patterns {
+		if p.matches(name, isDir) {
+			result = !p.negate
+		}
+	}
+	return result
+}
+
+// scriptWalker walks a script folder, honouring the global ignore list,
+// .devloopignore files at every level and the folder's max depth.
+type scriptWalker struct {
+	root     string
+	maxDepth int // 0 means unlimited
+	global   []ignorePattern
+	rules    map[string][]ignorePattern // effective rules per directory
+}
+
+func newScriptWalker(root string, cfg *Config) *scriptWalker {
+	return &scriptWalker{
+		root:     root,
+		maxDepth: cfg.folderSettings(root).MaxDepth,
+		global:   parseIgnorePatterns(cfg.ignorePatterns(), root),
+		rules:    make(map[string][]ignorePattern),
+	}
+}
+
+// rulesFor returns the patterns in effect for entries of dir: the global
+// list followed by every .devloopignore from the root down to dir.
+func (w *scriptWalker) rulesFor(dir string) []ignorePattern {
+	if rules, ok := w.rules[dir]; ok {
+		return rules
+	}
+	var inherited []ignorePattern
+	if parent := filepath.Dir(dir); dir != w.root && parent != dir && strings.HasPrefix(dir, w.root) {
+		inherited = w.rulesFor(parent)
+	} else {
+		inherited = w.global
+	}
+	own := readIgnoreFile(dir)
+	rules := append(append(make([]ignorePattern, 0, len(inherited)+len(own)), inherited...), own...)
+	w.rules[dir] = rules
+	return rules
+}
+
+// depth is the number of path segments of name below the root.
+func (w *scriptWalker) depth(name string) int {
+	rel, err := filepath.Rel(w.root, name)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return len(strings.Split(rel, string(filepath.Separator)))
+}
+
+// skip reports whether an entry below the root is ignored or too deep.
+func (w *scriptWalker) skip(name string, isDir bool) bool {
+	if w.maxDepth > 0 {
+		depth := w.depth(name)
+		if depth > w.maxDepth || (isDir && depth >= w.maxDepth) {
+			return true
+		}
+	}
+	return ignored(w.rulesFor(filepath.Dir(name)), name, isDir)
+}
+
+// walk calls fn for every directory and file under start that is not skipped.
+// start must be the root or a directory below it.
+func (w *scriptWalker) walk(start string, fn func(name string, d fs.DirEntry) error) error {
+	return filepath.WalkDir(start, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && name != start {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if name != w.root && w.skip(name, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(name, d)
+	})
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseIgnorePatterns(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []ignorePattern
+	}{
+		{"blank", "   ", nil},
+		{"comment", "# note", nil},
+		{"plain", "*.log", []ignorePattern{{base: "/r", glob: "*.log"}}},
+		{"trailing spaces", "*.log \t\r", []ignorePattern{{base: "/r", glob: "*.log"}}},
+		{"directory only", "build/", []ignorePattern{{base: "/r", glob: "build", dirOnly: true}}},
+		{"negated", "!keep.sh", []ignorePattern{{base: "/r", glob: "keep.sh", negate: true}}},
+		{"escaped hash", `\#x`, []ignorePattern{{base: "/r", glob: "#x"}}},
+		{"escaped bang", `\!x`, []ignorePattern{{base: "/r", glob: "!x"}}},
+		{"leading slash anchors", "/tmp", []ignorePattern{{base: "/r", glob: "tmp", anchored: true}}},
+		{"inner slash anchors", "a/*.sh", []ignorePattern{{base: "/r", glob: "a/*.sh", anchored: true}}},
+		{"only slash", "/", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseIgnorePatterns([]string{tt.line}, "/r"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIgnorePatterns(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	base := filepath.FromSlash("/r")
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{"basename at any level", []string{"*.log"}, "a/b/x.log", false, true},
+		{"no match", []string{"*.log"}, "a/x.sh", false, false},
+		{"directory pattern skips files", []string{"build/"}, "build", false, false},
+		{"directory pattern matches directories", []string{"build/"}, "a/build", true, true},
+		{"anchored matches from base", []string{"/tmp"}, "tmp", true, true},
+		{"anchored does not match deeper", []string{"/tmp"}, "a/tmp", true, false},
+		{"double star", []string{"a/**/x.sh"}, "a/b/c/x.sh", false, true},
+		{"double star matches zero segments", []string{"a/**/x.sh"}, "a/x.sh", false, true},
+		{"last pattern wins", []string{"*.sh", "!keep.sh"}, "keep.sh", false, false},
+		{"re-ignored after negation", []string{"*.sh", "!keep.sh", "keep.*"}, "keep.sh", false, true},
+		{"dot-dot prefixed file", []string{"*.sh"}, "..x.sh", false, true},
+		{"dots only file", []string{"*.sh"}, "...sh", false, true},
+		{"outside base", []string{"*.sh"}, "../x.sh", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns := parseIgnorePatterns(tt.patterns, base)
+			name := filepath.Join(base, filepath.FromSlash(tt.path))
+			if got := ignored(patterns, name, tt.isDir); got != tt.want {
+				t.Errorf("ignored(%v, %q) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptWalker(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"a.sh":                   "",
+		"..x.sh":                 "",
+		"skip.log":               "",
+		"node_modules/m.js":      "",
+		"sub/b.sh":               "",
+		"sub/.devloopignore":     "b.sh\n!keep.log\n",
+		"sub/keep.log":           "",
+		"sub/deep/c.sh":          "",
+		"sub/deep/deeper/d.sh":   "",
+		"other/.devloopignore":   "*\n",
+		"other/ignored-by-it.sh": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(cfg *Config) []string {
+		var got []string
+		w := newScriptWalker(root, cfg)
+		err := w.walk(root, func(name string, d os.DirEntry) error {
+			if !d.IsDir() {
+				rel, _ := filepath.Rel(root, name)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	cfg := &Config{IgnorePatterns: []string{"node_modules/", "*.log", ".devloopignore"}}
+	want := []string{"..x.sh", "a.sh", "sub/deep/c.sh", "sub/deep/deeper/d.sh", "sub/keep.log"}
+	if got := walk(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("walk = %v, want %v", got, want)
+	}
+
+	cfg.FolderSettings = map[string]FolderSettings{root: {MaxDepth: 2}}
+	want = []string{"..x.sh", "a.sh", "sub/keep.log"}
+	if got := walk(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("walk with max depth 2 = %v, want %v", got, want)
+	}
+}
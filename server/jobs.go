@@ -0,0 +1,161 @@
+package server
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// outputDrainTimeout is how long output is still read after a background run
+// exits, for children it started that keep its terminal or pipes open.
+const outputDrainTimeout = 2 * time.Second
+
+// job is a script run in progress that clients can attach to, registered
+// under its history ID until the process exits.
+type job struct {
+	ID        string
+	ScriptID  string
+	StartedAt time.Time
+	TTY       bool
+	input     io.Writer                     // terminal or stdin of the process
+	closeIn   func() error                  // ends the process input
+	resize    func(cols, rows uint16) error // nil unless the job runs under a terminal
+
+	inputMu sync.Mutex // keeps writes to the process input in order
+
+	mu          sync.Mutex
+	out         *outputSpool // output kept for history and replayed to new clients
+	subscribers map[chan []byte]struct{}
+	done        chan struct{}
+	exitCode    int
+}
+
+// jobRegistry holds the jobs that are currently running.
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+var jobs = &jobRegistry{jobs: make(map[string]*job)}
+
+func newJob(id, scriptID string, out *outputSpool) *job {
+	return &job{ID: id, ScriptID: scriptID, StartedAt: time.Now(), out: out, subscribers: make(map[chan []byte]struct{}), done: make(chan struct{})}
+}
+
+func (r *jobRegistry) add(j *job) {
+	r.mu.Lock()
+	r.jobs[j.ID] = j
+	r.mu.Unlock()
+}
+
+func (r *jobRegistry) get(id string) *job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.jobs[id]
+}
+
+func (r *jobRegistry) remove(id string) {
+	r.mu.Lock()
+	delete(r.jobs, id)
+	r.mu.Unlock()
+}
+
+// Write records process output and passes it on to attached clients. A
+// client that is not keeping up is detached rather than blocking the
+// process; it can attach again and replay the transcript.
+func (j *job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	select {
+	case <-j.done:
+		return len(p), nil // output of a background child after the run ended
+	default:
+	}
+	j.out.Write(p)
+	for ch := range j.subscribers {
+		select {
+		case ch <- append([]byte(nil), p...):
+		default:
+			delete(j.subscribers, ch)
+			close(ch)
+		}
+	}
+	return len(p), nil
+}
+
+// attach returns the output so far, or its head and tail when large, and a
+// channel carrying further output, closed when the job finishes.
+func (j *job) attach() ([]byte, chan []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	ch := make(chan []byte, 256)
+	if j.subscribers == nil {
+		close(ch)
+	} else {
+		j.subscribers[ch] = struct{}{}
+	}
+	return []byte(j.out.String()), ch
+}
+
+func (j *job) detach(ch chan []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.subscribers[ch]; ok {
+		delete(j.subscribers, ch)
+		close(ch)
+	}
+}
+
+// writeInput writes data to the process input, waiting for earlier writes
+// the process has not read yet.
+func (j *job) writeInput(data []byte) (int, error) {
+	j.inputMu.Lock()
+	defer j.inputMu.Unlock()
+	return j.input.Write(data)
+}
+
+// writeInitialInput writes the stdin a run was started with in the
+// background. The input lock is taken before it returns, so input sent or
+// closed once the job is registered lands after the initial payload.
+func (j *job) writeInitialInput(data []byte) {
+	j.inputMu.Lock()
+	go func() {
+		defer j.inputMu.Unlock()
+		j.input.Write(data)
+	}()
+}
+
+// closeInput ends the process input after any pending writes.
+func (j *job) closeInput() error {
+	j.inputMu.Lock()
+	defer j.inputMu.Unlock()
+	return j.closeIn()
+}
+
+// finish records the exit code and disconnects attached clients.
+func (j *job) finish(exitCode int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.exitCode = exitCode
+	for ch := range j.subscribers {
+		close(ch)
+	}
+	j.subscribers = nil
+	close(j.done)
+}
+
+// wait is called once an attach channel is closed. It blocks until the job
+// has finished and returns its exit code, or returns false right away when
+// the channel was closed because the client fell behind.
+func (j *job) wait() (bool, int) {
+	j.mu.Lock()
+	running := j.subscribers != nil
+	j.mu.Unlock()
+	if running {
+		return false, 0
+	}
+	<-j.done
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return true, j.exitCode
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Language describes how scripts written in one language are recognised,
+// where their metadata lives and how they are run.
+type Language struct {
+	Name          string   `json:"name"`
+	Extensions    []string `json:"extensions"`              // matched against the end of the file name, longest first
+	CommentPrefix string   `json:"commentPrefix,omitempty"` // line comment marker, defaults to "#"
+	Interpreter   string   `json:"interpreter,omitempty"`   // command the script path is appended to, empty runs the file directly
+	// Compile is an optional build command run before execution, with {src}
+	// replaced by the script path and {out} by the binary to produce. The
+	// binary is then run in place of the script. Binaries are cached, see buildScript.
+	Compile string `json:"compile,omitempty"`
+	// Version is a command printing the toolchain version, so that upgrading
+	// the toolchain invalidates cached builds.
+	Version string `json:"version,omitempty"`
+}
+
+// builtinLanguages are available without any configuration. Entries in
+// Config.Languages with the same name replace them.
+var builtinLanguages = []Language{
+	{Name: "python", Extensions: []string{".py"}, CommentPrefix: "#", Interpreter: "python"},
+	{Name: "node", Extensions: []string{".js", ".mjs", ".cjs"}, CommentPrefix: "//", Interpreter: "node"},
+	{Name: "typescript", Extensions: []string{".ts"}, CommentPrefix: "//", Interpreter: "ts-node"},
+	{Name: "go", Extensions: []string{".go"}, CommentPrefix: "//", Compile: "go build -o {out} {src}", Version: "go env GOVERSION"},
+	{Name: "bash", Extensions: []string{".sh", ".bash"}, CommentPrefix: "#", Interpreter: "bash"},
+	{Name: "zsh", Extensions: []string{".zsh"}, CommentPrefix: "#", Interpreter: "zsh"},
+	{Name: "zx", Extensions: []string{".zx"}, CommentPrefix: "//", Interpreter: "zx"},
+	{Name: "ruby", Extensions: []string{".rb"}, CommentPrefix: "#", Interpreter: "ruby"},
+	{Name: "perl", Extensions: []string{".pl"}, CommentPrefix: "#", Interpreter: "perl"},
+	{Name: "powershell", Extensions: []string{".ps1"}, CommentPrefix: "#", Interpreter: "pwsh -NoProfile -NonInteractive -File"},
+	{Name: "lua", Extensions: []string{".lua"}, CommentPrefix: "--", Interpreter: "lua"},
+	{Name: "php", Extensions: []string{".php"}, CommentPrefix: "//", Interpreter: "php"},
+	{Name: "deno", Extensions: []string{".deno.ts", ".deno.js"}, CommentPrefix: "//", Interpreter: "deno run --allow-all"},
+	{Name: "bun", Extensions: []string{".bun.ts", ".bun.js"}, CommentPrefix: "//", Interpreter: "bun run"},
+}
+
+// languages returns the configured languages followed by the built-ins they
+// do not replace.
+func (c *Config) languages() []Language {
+	languages := append([]Language{}, c.Languages...)
+	for _, builtin := range builtinLanguages {
+		replaced := false
+		for _, l := range c.Languages {
+			if l.Name == builtin.Name {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			languages = append(languages, builtin)
+		}
+	}
+	return languages
+}
+
+// languageFor returns the language of a script path, matching the longest
+// extension so that ".deno.ts" wins over ".ts". ExtensionCommands entries
+// override the interpreter of a built-in language for their extension,
+// running the source without a compile step, or register a "#"-commented
+// language of their own when no definition matches. A language defined in
+// Config.Languages is never overridden by an ExtensionCommands entry for the
+// same extension.
+func (c *Config) languageFor(path string) (Language, bool) {
+	base := strings.ToLower(filepath.Base(path))
+	var (
+		match      Language
+		matchExt   string
+		configured bool
+	)
+	for i, l := range c.languages() {
+		for _, ext := range l.Extensions {
+			if len(ext) > len(matchExt) && strings.HasSuffix(base, strings.ToLower(ext)) {
+				match, matchExt, configured = l, ext, i < len(c.Languages)
+			}
+		}
+	}
+	for ext, command := range c.ExtensionCommands {
+		if len(ext) < len(matchExt) || configured && len(ext) == len(matchExt) || !strings.HasSuffix(base, strings.ToLower(ext)) {
+			continue
+		}
+		if !strings.EqualFold(ext, matchExt) {
+			match = Language{Name: strings.TrimPrefix(ext, "."), Extensions: []string{ext}}
+		}
+		match.Interpreter, match.Compile, matchExt = command, "", ext
+	}
+	if matchExt == "" {
+		return Language{}, false
+	}
+	if match.CommentPrefix == "" {
+		match.CommentPrefix = "#"
+	}
+	return match, true
+}
+
+// languageForShebang returns the language whose interpreter is named on a #!
+// line, so "/usr/bin/env python3" resolves to python.
+func (c *Config) languageForShebang(shebang string) (Language, bool) {
+	fields := strings.Fields(shebang)
+	if len(fields) > 0 && filepath.Base(fields[0]) == "env" {
+		fields = fields[1:]
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+			fields = fields[1:]
+		}
+	}
+	if len(fields) == 0 {
+		return Language{}, false
+	}
+	program := filepath.Base(fields[0])
+	for _, l := range c.languages() {
+		names := []string{l.Name}
+		if interpreter := strings.Fields(l.Interpreter); len(interpreter) > 0 {
+			names = append(names, filepath.Base(interpreter[0]))
+		}
+		for _, name := range names {
+			// Allow versioned interpreters such as python3 or ruby3.2
+			if strings.HasPrefix(program, name) && strings.Trim(program[len(name):], "0123456789.") == "" {
+				if l.CommentPrefix == "" {
+					l.CommentPrefix = "#"
+				}
+				return l, true
+			}
+		}
+	}
+	return Language{}, false
+}
+
+// commentFor returns the line comment marker used for metadata in a file,
+// looking at its #! line when the extension is not registered.
+func (c *Config) commentFor(path, content string) string {
+	if l, ok := c.languageFor(path); ok {
+		return l.CommentPrefix
+	}
+	if l, ok := c.languageForShebang(shebangOf(content)); ok {
+		return l.CommentPrefix
+	}
+	return "#"
+}
+
+// directCommand returns the command used to run a script without a language
+// interpreter: empty when the file is executable so it runs directly,
+// otherwise the interpreter named on its #! line.
+func directCommand(script *Script) (string, error) {
+	info, err := os.Stat(script.Path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0111 != 0 && runtime.GOOS != "windows" {
+		return "", nil
+	}
+	if script.Shebang != "" {
+		return script.Shebang, nil
+	}
+	return "", fmt.Errorf("script %s is not executable and has no interpreter", filepath.Base(script.Path))
+}
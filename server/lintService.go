@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LintResult holds the diagnostics for one script file.
+type LintResult struct {
+	ID          string       `json:"id,omitempty"`
+	Name        string       `json:"name,omitempty"`
+	Path        string       `json:"path"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+func getScriptDiagnosticsHandler(c *gin.Context) {
+	script, err := storage.GetScript(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "script not found"})
+		return
+	}
+	diagnostics := script.Diagnostics
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	c.JSON(http.StatusOK, LintResult{ID: script.ID, Name: script.Name, Path: script.Path, Diagnostics: diagnostics})
+}
+
+// lintScriptsHandler re-parses the given files, or every registered script when
+// none are given, and reports their diagnostics without updating storage.
+func lintScriptsHandler(c *gin.Context) {
+	var req struct {
+		Paths []string `json:"paths"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load config"})
+		return
+	}
+	paths := req.Paths
+	if len(paths) == 0 {
+		scripts, err := storage.ListScripts(ScriptQuery{Limit: -1})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		for _, script := range scripts {
+			paths = append(paths, script.Path)
+		}
+	}
+
+	results := []LintResult{}
+	var errors, warnings, failing int
+	linted := make(map[string]struct{})
+	for _, path := range paths {
+		path = expandHome(path)
+		// Project files hold several tasks but are linted once
+		if _, ok := linted[path]; ok {
+			continue
+		}
+		linted[path] = struct{}{}
+		result := LintResult{Path: path, Diagnostics: []Diagnostic{}}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{Message: "cannot read file: " + err.Error(), Severity: severityError})
+		} else if provider := cfg.taskProviderFor(path); provider != nil {
+			if _, err := provider.parse(path, string(content)); err != nil {
+				result.Diagnostics = append(result.Diagnostics, Diagnostic{Message: err.Error(), Severity: severityError})
+			}
+		} else if script, err := parseScript(path, string(content), cfg.commentFor(path, string(content))); err != nil {
+			result.Diagnostics = append(result.Diagnostics, Diagnostic{Message: err.Error(), Severity: severityError})
+		} else {
+			result.ID, result.Name = script.ID, script.Name
+			result.Diagnostics = append(result.Diagnostics, script.Diagnostics...)
+		}
+		count := errorCount(result.Diagnostics)
+		if count > 0 {
+			failing++
+		}
+		errors += count
+		warnings += len(result.Diagnostics) - count
+		results = append(results, result)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"summary": gin.H{"scripts": len(results), "failing": failing, "errors": errors, "warnings": warnings},
+	})
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// OutputLimits bounds the output a run keeps. Zero values use the defaults.
+type OutputLimits struct {
+	MaxBytes     int64 `json:"maxBytes,omitempty"`     // output past this is dropped, default 1 GiB
+	SpoolBytes   int64 `json:"spoolBytes,omitempty"`   // output past this is written to a compressed log file, default 1 MiB
+	PreviewBytes int   `json:"previewBytes,omitempty"` // head and tail kept in history for spooled output, default 32 KiB each
+}
+
+func (l OutputLimits) withDefaults() OutputLimits {
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = 1 << 30
+	}
+	if l.SpoolBytes <= 0 {
+		l.SpoolBytes = 1 << 20
+	}
+	if l.PreviewBytes <= 0 {
+		l.PreviewBytes = 32 << 10
+	}
+	return l
+}
+
+// outputLogPath returns the compressed log file of a history entry. It is
+// removed together with the entry by DeleteHistoryByID.
+func outputLogPath(historyID string) string {
+	return filepath.Join(getConfigFolderPath(), "logs", historyID+".log.gz")
+}
+
+// outputSpool captures the output of a run. Output is kept in memory up to
+// SpoolBytes; past that it is written to a gzip log file and only the head
+// and tail are kept for the history preview. A spool without a path, as used
+// by incognito runs, keeps only the preview and never writes to disk. Output
+// past MaxBytes is dropped while the process keeps running.
+type outputSpool struct {
+	mu      sync.Mutex
+	limits  OutputLimits
+	path    string
+	buf     bytes.Buffer // all output until spooled, then only the head
+	tail    []byte       // end of the output once spooled
+	spooled bool
+	file    *os.File
+	gz      *gzip.Writer
+	size    int64 // bytes kept
+	dropped int64 // bytes past MaxBytes
+	err     error // first error writing the log file
+}
+
+func newOutputSpool(limits OutputLimits, path string) *outputSpool {
+	return &outputSpool{limits: limits.withDefaults(), path: path}
+}
+
+func (s *outputSpool) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(p)
+	if room := s.limits.MaxBytes - s.size; int64(len(p)) > room {
+		s.dropped += int64(len(p)) - max(room, 0)
+		p = p[:max(room, 0)]
+	}
+	s.size += int64(len(p))
+	if !s.spooled {
+		s.buf.Write(p)
+		if int64(s.buf.Len()) > s.limits.SpoolBytes {
+			s.spool()
+		}
+		return n, nil
+	}
+	if s.gz != nil && s.err == nil {
+		_, s.err = s.gz.Write(p)
+	}
+	s.tail = append(s.tail, p...)
+	// Trim in batches so the tail is not copied on every write
+	if len(s.tail) > 2*s.limits.PreviewBytes {
+		s.tail = append(s.tail[:0], s.tail[len(s.tail)-s.limits.PreviewBytes:]...)
+	}
+	return n, nil
+}
+
+// spool moves the buffered output into the log file, keeping head and tail.
+func (s *outputSpool) spool() {
+	s.spooled = true
+	data := s.buf.Bytes()
+	s.tail = append([]byte(nil), data[max(len(data)-s.limits.PreviewBytes, 0):]...)
+	defer s.buf.Truncate(min(s.limits.PreviewBytes, len(data)))
+
+	// Without a log file only the preview survives
+	if s.path == "" {
+		return
+	}
+	if s.err = os.MkdirAll(filepath.Dir(s.path), 0755); s.err != nil {
+		return
+	}
+	if s.file, s.err = os.OpenFile(s.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600); s.err != nil {
+		return
+	}
+	s.gz = gzip.NewWriter(s.file)
+	_, s.err = s.gz.Write(data)
+}
+
+// appendSpool closes src, the spool of a single attempt, and appends the
+// output it kept to s, reading its log file when it was spooled.
+func (s *outputSpool) appendSpool(src *outputSpool) error {
+	src.close()
+	if path := src.logFile(); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		if _, err := io.Copy(s, gz); err != nil {
+			return err
+		}
+	} else {
+		s.Write([]byte(src.String()))
+	}
+	_, dropped := src.stats()
+	s.mu.Lock()
+	s.dropped += dropped
+	s.mu.Unlock()
+	return nil
+}
+
+// stats returns the number of bytes kept and dropped.
+func (s *outputSpool) stats() (int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size, s.dropped
+}
+
+// close flushes the log file. The spool can still render its preview.
+func (s *outputSpool) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return
+	}
+	if err := s.gz.Close(); err != nil && s.err == nil {
+		s.err = err
+	}
+	s.file.Close()
+	s.file, s.gz = nil, nil
+}
+
+// discard closes and removes the log file, for runs that keep no output.
+func (s *outputSpool) discard() {
+	s.close()
+	if s.spooled && s.path != "" {
+		os.Remove(s.path)
+	}
+}
+
+// logFile returns the log file holding the full output, if it was spooled.
+func (s *outputSpool) logFile() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.spooled || s.err != nil {
+		return ""
+	}
+	return s.path
+}
+
+// String returns the output, or for spooled output its head and tail cut
+// at line boundaries around a note pointing to the log file.
+func (s *outputSpool) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	if !s.spooled {
+		b.Write(s.buf.Bytes())
+	} else {
+		head, tail := s.buf.Bytes(), s.tail
+		if len(tail) > s.limits.PreviewBytes {
+			tail = tail[len(tail)-s.limits.PreviewBytes:]
+		}
+		if i := bytes.LastIndexByte(head, '\n'); i >= 0 {
+			head = head[:i+1]
+		}
+		if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+			tail = tail[i+1:]
+		}
+		omitted := s.size - int64(len(head)) - int64(len(tail))
+		where := "the log file could not be written: " + fmt.Sprint(s.err)
+		switch {
+		case s.path == "":
+			where = "the full output is not kept"
+		case s.err == nil:
+			where = "full output in " + s.path
+		}
+		b.Write(head)
+		fmt.Fprintf(&b, "\n… %d bytes omitted, %s …\n\n", omitted, where)
+		b.Write(tail)
+	}
+	if s.dropped > 0 {
+		fmt.Fprintf(&b, "\n… output truncated at %d bytes, %d bytes dropped …\n", s.limits.MaxBytes, s.dropped)
+	}
+	return b.String()
+}
+
+// Units of a ranged output read.
+const (
+	rangeLines = "lines"
+	rangeBytes = "bytes"
+)
+
+// OutputRange describes the part of the output returned by a ranged read.
+type OutputRange struct {
+	Unit   string `json:"unit"`
+	Offset int64  `json:"offset"`
+	Limit  int64  `json:"limit"`
+	Next   int64  `json:"next"` // offset of the following range
+	More   bool   `json:"more"` // whether output continues past this range
+	// Truncated is set when a line range reached the byte limit of a range
+	// and the rest of the line was skipped.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// errRangeUnavailable is returned for ranged reads of spooled output whose
+// log file could not be written, so only the preview exists.
+var errRangeUnavailable = errors.New("range unavailable: the full output was not saved, only its preview")
+
+// readOutputRange reads limit lines or bytes of a history entry's output
+// starting at offset, from its log file when the output was spooled. Both
+// hold the output as the script printed it, so offsets mean the same for
+// every entry. Line ranges are bounded by the byte limit of a range as well,
+// however long their lines.
+func readOutputRange(h *ExecutionHistory, r *OutputRange) (string, error) {
+	var source io.Reader = strings.NewReader(h.Output)
+	if h.LogFile != "" {
+		f, err := os.Open(h.LogFile)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		source = gz
+	} else if h.OutputSize > int64(len(h.Output)) {
+		return "", errRangeUnavailable
+	}
+	reader := bufio.NewReader(source)
+	var out bytes.Buffer
+	if r.Unit == rangeBytes {
+		if _, err := io.CopyN(io.Discard, reader, r.Offset); err != nil && err != io.EOF {
+			return "", err
+		}
+		if _, err := io.CopyN(&out, reader, r.Limit); err != nil && err != io.EOF {
+			return "", err
+		}
+		r.Next = r.Offset + int64(out.Len())
+	} else {
+		for skipped := int64(0); skipped < r.Offset; {
+			_, err := reader.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				continue // still inside a long line
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			skipped++
+		}
+		budget := maxRangeLimits[rangeBytes]
+		for r.Next = r.Offset; r.Next < r.Offset+r.Limit && budget > 0; {
+			// Read the line in pieces, keeping what fits in the budget
+			read := 0
+			var err error
+			for {
+				var chunk []byte
+				chunk, err = reader.ReadSlice('\n')
+				read += len(chunk)
+				keep := min(int64(len(chunk)), budget)
+				out.Write(chunk[:keep])
+				budget -= keep
+				r.Truncated = r.Truncated || keep < int64(len(chunk))
+				if err != bufio.ErrBufferFull {
+					break
+				}
+			}
+			if read > 0 {
+				r.Next++
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	_, err := reader.Peek(1)
+	r.More = err == nil
+	return out.String(), nil
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns n lines "line 0\n", "line 1\n", ...
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestOutputSpool(t *testing.T) {
+	output := numberedLines(200) // 1890 bytes
+	tests := []struct {
+		name        string
+		limits      OutputLimits
+		writes      int // output is written in this many chunks
+		wantSize    int64
+		wantDropped int64
+		spooled     bool
+	}{
+		{"kept in memory", OutputLimits{SpoolBytes: 4096, PreviewBytes: 100}, 7, int64(len(output)), 0, false},
+		{"exactly at the spool limit", OutputLimits{SpoolBytes: int64(len(output)), PreviewBytes: 100}, 3, int64(len(output)), 0, false},
+		{"one byte past the spool limit", OutputLimits{SpoolBytes: int64(len(output)) - 1, PreviewBytes: 100}, 1, int64(len(output)), 0, true},
+		{"spooled across writes", OutputLimits{SpoolBytes: 500, PreviewBytes: 100}, 13, int64(len(output)), 0, true},
+		{"capped in memory", OutputLimits{MaxBytes: 1000, SpoolBytes: 4096, PreviewBytes: 100}, 9, 1000, int64(len(output)) - 1000, false},
+		{"capped after spooling", OutputLimits{MaxBytes: 1000, SpoolBytes: 500, PreviewBytes: 100}, 9, 1000, int64(len(output)) - 1000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "logs", "run.log.gz")
+			s := newOutputSpool(tt.limits, path)
+			chunk := (len(output) + tt.writes - 1) / tt.writes
+			for i := 0; i < len(output); i += chunk {
+				p := output[i:min(i+chunk, len(output))]
+				if n, err := s.Write([]byte(p)); n != len(p) || err != nil {
+					t.Fatalf("Write = %d, %v, want %d, nil", n, err, len(p))
+				}
+			}
+			s.close()
+
+			size, dropped := s.stats()
+			if size != tt.wantSize || dropped != tt.wantDropped {
+				t.Errorf("stats = %d, %d, want %d, %d", size, dropped, tt.wantSize, tt.wantDropped)
+			}
+			kept := output[:tt.wantSize]
+			preview := s.String()
+			if !tt.spooled {
+				if s.logFile() != "" {
+					t.Errorf("logFile = %q, want none", s.logFile())
+				}
+				if !strings.HasPrefix(preview, kept) {
+					t.Errorf("preview does not start with the whole output: %q", preview)
+				}
+			} else {
+				if s.logFile() != path {
+					t.Fatalf("logFile = %q, want %q", s.logFile(), path)
+				}
+				if got := readGzip(t, path); got != kept {
+					t.Errorf("log file holds %d bytes, want the %d bytes kept", len(got), len(kept))
+				}
+				head, tail := kept[:100], kept[len(kept)-100:]
+				head = head[:strings.LastIndexByte(head, '\n')+1]
+				tail = tail[strings.IndexByte(tail, '\n')+1:]
+				if !strings.HasPrefix(preview, head) || !strings.Contains(preview, "bytes omitted, full output in "+path) {
+					t.Errorf("preview = %q, want head %q and a note", preview, head)
+				}
+				if !strings.Contains(preview, "…\n\n"+tail) {
+					t.Errorf("preview = %q, want tail %q", preview, tail)
+				}
+			}
+			if wantNote := tt.wantDropped > 0; strings.Contains(preview, "bytes dropped") != wantNote {
+				t.Errorf("preview = %q, want dropped note %v", preview, wantNote)
+			}
+
+			s.discard()
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("log file still exists after discard: %v", err)
+			}
+		})
+	}
+}
+
+func TestOutputSpoolWithoutLogFile(t *testing.T) {
+	// A file where the logs folder should be makes the log file impossible
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "logs")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := newOutputSpool(OutputLimits{SpoolBytes: 100, PreviewBytes: 50}, filepath.Join(blocker, "run.log.gz"))
+	output := numberedLines(100)
+	s.Write([]byte(output))
+	s.close()
+	if s.logFile() != "" {
+		t.Errorf("logFile = %q, want none", s.logFile())
+	}
+	preview := s.String()
+	if !strings.Contains(preview, "the log file could not be written") {
+		t.Errorf("preview = %q, want a note about the log file", preview)
+	}
+
+	h := &ExecutionHistory{Output: preview, OutputSize: int64(len(output))}
+	if _, err := readOutputRange(h, &OutputRange{Unit: rangeLines, Limit: 10}); !errors.Is(err, errRangeUnavailable) {
+		t.Errorf("readOutputRange = %v, want errRangeUnavailable", err)
+	}
+}
+
+func TestAppendSpool(t *testing.T) {
+	dir := t.TempDir()
+	limits := OutputLimits{MaxBytes: 3000, SpoolBytes: 500, PreviewBytes: 100}
+	run := newOutputSpool(limits, filepath.Join(dir, "run.log.gz"))
+	run.Write([]byte("first repeat\n"))
+
+	// An attempt large enough to be spooled itself, and one that is not
+	attempt := newOutputSpool(limits, filepath.Join(dir, "attempt.log.gz"))
+	attempt.Write([]byte(numberedLines(100)))
+	if err := run.appendSpool(attempt); err != nil {
+		t.Fatal(err)
+	}
+	attempt.discard()
+	small := newOutputSpool(limits, filepath.Join(dir, "small.log.gz"))
+	small.Write([]byte("done\n"))
+	if err := run.appendSpool(small); err != nil {
+		t.Fatal(err)
+	}
+	run.close()
+
+	want := "first repeat\n" + numberedLines(100) + "done\n"
+	if got := readGzip(t, run.logFile()); got != want {
+		t.Errorf("run output = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "attempt.log.gz")); !os.IsNotExist(err) {
+		t.Errorf("attempt log file still exists: %v", err)
+	}
+}
+
+func TestReadOutputRange(t *testing.T) {
+	output := "a\nbb\n" + strings.Repeat("x", 10) + "\nlast"
+	tests := []struct {
+		name      string
+		r         OutputRange
+		want      string
+		wantNext  int64
+		wantMore  bool
+		truncated bool
+	}{
+		{"first lines", OutputRange{Unit: rangeLines, Offset: 0, Limit: 2}, "a\nbb\n", 2, true, false},
+		{"lines to the end", OutputRange{Unit: rangeLines, Offset: 2, Limit: 10}, strings.Repeat("x", 10) + "\nlast", 4, false, false},
+		{"line offset past the end", OutputRange{Unit: rangeLines, Offset: 10, Limit: 1}, "", 10, false, false},
+		{"bytes", OutputRange{Unit: rangeBytes, Offset: 1, Limit: 4}, "\nbb\n", 5, true, false},
+		{"bytes to the end", OutputRange{Unit: rangeBytes, Offset: 16, Limit: 100}, "last", 20, false, false},
+		{"byte offset past the end", OutputRange{Unit: rangeBytes, Offset: 100, Limit: 1}, "", 100, false, false},
+	}
+	for _, spooled := range []bool{false, true} {
+		h := &ExecutionHistory{Output: output, OutputSize: int64(len(output))}
+		if spooled {
+			// Spooled entries keep only a preview; the log file has everything
+			h.LogFile = filepath.Join(t.TempDir(), "run.log.gz")
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write([]byte(output))
+			gz.Close()
+			if err := os.WriteFile(h.LogFile, buf.Bytes(), 0600); err != nil {
+				t.Fatal(err)
+			}
+			h.Output = "preview"
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s spooled=%v", tt.name, spooled), func(t *testing.T) {
+				r := tt.r
+				got, err := readOutputRange(h, &r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want || r.Next != tt.wantNext || r.More != tt.wantMore || r.Truncated != tt.truncated {
+					t.Errorf("readOutputRange(%+v) = %q next %d more %v truncated %v, want %q next %d more %v truncated %v",
+						tt.r, got, r.Next, r.More, r.Truncated, tt.want, tt.wantNext, tt.wantMore, tt.truncated)
+				}
+			})
+		}
+	}
+}
+
+func TestReadOutputRangeBoundsLongLines(t *testing.T) {
+	limit := maxRangeLimits[rangeBytes]
+	output := strings.Repeat("y", int(limit)+10) + "\nnext\n"
+	h := &ExecutionHistory{Output: output, OutputSize: int64(len(output))}
+	r := &OutputRange{Unit: rangeLines, Limit: 2}
+	got, err := readOutputRange(h, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(got)) != limit || !r.Truncated || r.Next != 1 || !r.More {
+		t.Errorf("read %d bytes, truncated %v, next %d, more %v; want %d bytes of the first line", len(got), r.Truncated, r.Next, r.More, limit)
+	}
+}
+
+func TestOutputSpoolWithoutPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	s := newOutputSpool(OutputLimits{SpoolBytes: 100, PreviewBytes: 50}, "")
+	s.Write([]byte(numberedLines(100)))
+	s.close()
+	if s.logFile() != "" {
+		t.Errorf("logFile = %q, want none", s.logFile())
+	}
+	if preview := s.String(); !strings.Contains(preview, "the full output is not kept") || !strings.HasPrefix(preview, "line 0\n") {
+		t.Errorf("preview = %q, want head, tail and a note", preview)
+	}
+	s.discard()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("spool without a path wrote %d entries to disk", len(entries))
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ToolRequirement is one entry of @requires, such as "kubectl >= 1.28".
+type ToolRequirement struct {
+	Tool    string
+	Op      string // one of >=, <=, >, <, =, != or empty for any version
+	Version string
+}
+
+// ToolStatus describes a requirement that is not satisfied.
+type ToolStatus struct {
+	Requirement string `json:"requirement"`
+	Path        string `json:"path,omitempty"`
+	Version     string `json:"version,omitempty"` // version found, when the tool exists
+	Error       string `json:"error"`
+}
+
+// Readiness reports whether every tool a script requires is available.
+type Readiness struct {
+	Ready     bool         `json:"ready"`
+	Missing   []ToolStatus `json:"missing,omitempty"`
+	CheckedAt time.Time    `json:"checkedAt"`
+}
+
+var (
+	requirementRe = regexp.MustCompile(`^([A-Za-z0-9_.+/-]+)\s*(?:(>=|<=|==|!=|>|<|=)\s*v?([0-9][0-9A-Za-z.+-]*))?$`)
+	versionRe     = regexp.MustCompile(`\d+(?:\.\d+)+|\d+`)
+	dottedRe      = regexp.MustCompile(`\d+(?:\.\d+)+`)
+)
+
+// versionProbes are the arguments printing a tool's version when
+// "--version" does not work.
+var versionProbes = map[string][]string{
+	"kubectl": {"version", "--client"},
+	"go":      {"version"},
+	"java":    {"-version"},
+	"helm":    {"version", "--short"},
+}
+
+// parseRequirement parses a single @requires entry.
+func parseRequirement(s string) (ToolRequirement, error) {
+	m := requirementRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return ToolRequirement{}, fmt.Errorf("invalid requirement %q, expected a tool name optionally followed by a constraint such as \">= 1.2\"", s)
+	}
+	op := m[2]
+	if op == "==" {
+		op = "="
+	}
+	return ToolRequirement{Tool: m[1], Op: op, Version: m[3]}, nil
+}
+
+func (r ToolRequirement) String() string {
+	if r.Op == "" {
+		return r.Tool
+	}
+	return r.Tool + " " + r.Op + " " + r.Version
+}
+
+// compareVersions compares dotted numeric versions, treating missing
+// components as zero so that 1.28 equals 1.28.0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// satisfies reports whether a found version meets the constraint.
+func (r ToolRequirement) satisfies(version string) bool {
+	want := versionRe.FindString(r.Version)
+	cmp := compareVersions(version, want)
+	switch r.Op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "=":
+		// "= 1.28" accepts any 1.28.x
+		parts := strings.Split(version, ".")
+		if n := len(strings.Split(want, ".")); len(parts) > n {
+			parts = parts[:n]
+		}
+		return compareVersions(strings.Join(parts, "."), want) == 0
+	case "!=":
+		return cmp != 0
+	}
+	return true
+}
+
+// probedVersion caches a tool's version by binary path and modification time,
+// so checks only run the tool again after it was replaced.
+type probedVersion struct {
+	modTime time.Time
+	version string
+	err     error
+}
+
+var versionCache sync.Map // path -> probedVersion
+
+// toolVersionAt returns the version printed by the tool at path.
+func toolVersionAt(tool, path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if cached, ok := versionCache.Load(path); ok && cached.(probedVersion).modTime.Equal(info.ModTime()) {
+		return cached.(probedVersion).version, cached.(probedVersion).err
+	}
+	probes := [][]string{{"--version"}}
+	if probe, ok := versionProbes[tool]; ok {
+		probes = [][]string{probe, {"--version"}}
+	}
+	version, err := "", fmt.Errorf("could not determine the version of %s", tool)
+	for _, args := range probes {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		out, _ := exec.CommandContext(ctx, path, args...).CombinedOutput()
+		cancel()
+		// Prefer a dotted version over other numbers, as in "perl 5, version 34 (v5.34.0)"
+		v := dottedRe.FindString(string(out))
+		if v == "" {
+			v = versionRe.FindString(string(out))
+		}
+		if v != "" {
+			version, err = v, nil
+			break
+		}
+	}
+	versionCache.Store(path, probedVersion{modTime: info.ModTime(), version: version, err: err})
+	return version, err
+}
+
+// lookPathIn is exec.LookPath searching the given PATH list rather than the
+// server's own, so tools are found where the run will find them.
+func lookPathIn(tool, path string) (string, error) {
+	if strings.ContainsAny(tool, `/\`) {
+		return exec.LookPath(tool)
+	}
+	exts := []string{""}
+	if runtime.GOOS == "windows" {
+		exts = filepath.SplitList(strings.ToLower(os.Getenv("PATHEXT")))
+		if len(exts) == 0 {
+			exts = []string{".com", ".exe", ".bat", ".cmd"}
+		}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		for _, ext := range exts {
+			candidate := filepath.Join(dir, tool+ext)
+			info, err := os.Stat(candidate)
+			if err == nil && !info.IsDir() && (runtime.GOOS == "windows" || info.Mode()&0111 != 0) {
+				return candidate, nil
+			}
+		}
+	}
+	return "", exec.ErrNotFound
+}
+
+// readinessPath returns the PATH a run of the script without request
+// variables would use: the server's, overridden by config and then the
+// default profile, behind the folders of its installed dependency
+// environments. Reloads check @requires against it so the list agrees with exec.
+func readinessPath(cfg *Config, script *Script) string {
+	path := os.Getenv("PATH")
+	if v, ok := cfg.EnvironmentVariables["PATH"]; ok {
+		path = v
+	}
+	if _, profile, err := resolveProfile(cfg, ""); err == nil && profile != nil {
+		if v, ok := profile.Variables["PATH"]; ok {
+			path = v
+		}
+	}
+	if entries := preparedPathEntries(script); len(entries) > 0 {
+		path = strings.Join(append(entries, path), string(os.PathListSeparator))
+	}
+	return path
+}
+
+// checkRequirements looks up every required tool on path, a PATH list that
+// defaults to the server's own, and verifies its version constraint.
+func checkRequirements(requires []string, path string) *Readiness {
+	if path == "" {
+		path = os.Getenv("PATH")
+	}
+	readiness := &Readiness{Ready: true, CheckedAt: time.Now()}
+	for _, entry := range requires {
+		status := ToolStatus{Requirement: entry}
+		req, err := parseRequirement(entry)
+		if err != nil {
+			status.Error = err.Error()
+			readiness.Missing = append(readiness.Missing, status)
+			continue
+		}
+		status.Requirement = req.String()
+		status.Path, err = lookPathIn(req.Tool, path)
+		if err != nil {
+			status.Error = "not found on PATH"
+			readiness.Missing = append(readiness.Missing, status)
+			continue
+		}
+		if req.Op == "" {
+			continue
+		}
+		status.Version, err = toolVersionAt(req.Tool, status.Path)
+		if err != nil {
+			status.Error = err.Error()
+			readiness.Missing = append(readiness.Missing, status)
+			continue
+		}
+		if !req.satisfies(status.Version) {
+			status.Error = "version " + status.Version + " does not satisfy " + req.Op + " " + req.Version
+			readiness.Missing = append(readiness.Missing, status)
+		}
+	}
+	readiness.Ready = len(readiness.Missing) == 0
+	return readiness
+}
+
+// summary lists the unmet requirements for error messages.
+func (r *Readiness) summary() string {
+	parts := make([]string, 0, len(r.Missing))
+	for _, m := range r.Missing {
+		parts = append(parts, m.Requirement+" ("+m.Error+")")
+	}
+	return strings.Join(parts, ", ")
+}
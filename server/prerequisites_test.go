@@ -0,0 +1,139 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseRequirement(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ToolRequirement
+		wantErr bool
+	}{
+		{in: "jq", want: ToolRequirement{Tool: "jq"}},
+		{in: "  kubectl >= 1.28  ", want: ToolRequirement{Tool: "kubectl", Op: ">=", Version: "1.28"}},
+		{in: "node>=v18", want: ToolRequirement{Tool: "node", Op: ">=", Version: "18"}},
+		{in: "go == 1.22", want: ToolRequirement{Tool: "go", Op: "=", Version: "1.22"}},
+		{in: "python3 != 3.12.0rc1", want: ToolRequirement{Tool: "python3", Op: "!=", Version: "3.12.0rc1"}},
+		{in: "g++ < 14", want: ToolRequirement{Tool: "g++", Op: "<", Version: "14"}},
+		{in: "", wantErr: true},
+		{in: "kubectl >=", wantErr: true},
+		{in: "kubectl ~ 1.2", wantErr: true},
+		{in: "two words", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseRequirement(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRequirement(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseRequirement(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		requirement string
+		version     string
+		want        bool
+	}{
+		{"jq", "1.6", true},
+		{"kubectl >= 1.28", "1.28.0", true},
+		{"kubectl >= 1.28", "1.29.3", true},
+		{"kubectl >= 1.28", "1.27.9", false},
+		{"kubectl >= 1.28", "1.100", true},
+		{"node > 18", "18.0.1", true},
+		{"node > 18", "18", false},
+		{"node <= 20.1", "20.1.0", true},
+		{"node < 20", "20.0.0", false},
+		{"go = 1.22", "1.22.5", true},
+		{"go = 1.22", "1.23.0", false},
+		{"go = 1.22.1", "1.22.10", false},
+		{"python3 != 3.12", "3.12.0", false},
+		{"python3 != 3.12", "3.11.9", true},
+		{"python3 >= 3.12.0rc1", "3.12.0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.requirement+" "+tt.version, func(t *testing.T) {
+			req, err := parseRequirement(tt.requirement)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := req.satisfies(tt.version); got != tt.want {
+				t.Errorf("%q satisfies %s = %v, want %v", tt.requirement, tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRequirements(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the tool")
+	}
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "devloop-fake-tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho \"fake-tool version 2.4.1 (build 7)\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		requires []string
+		path     string
+		missing  []string // requirements reported as missing
+	}{
+		{"found on the given PATH", []string{"devloop-fake-tool >= 2.4"}, dir, nil},
+		{"not on the given PATH", []string{"devloop-fake-tool"}, t.TempDir(), []string{"devloop-fake-tool"}},
+		{"version too old", []string{"devloop-fake-tool >= 3"}, dir, []string{"devloop-fake-tool >= 3"}},
+		{"invalid entry", []string{"devloop-fake-tool ~ 1"}, dir, []string{"devloop-fake-tool ~ 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readiness := checkRequirements(tt.requires, tt.path)
+			var missing []string
+			for _, m := range readiness.Missing {
+				missing = append(missing, m.Requirement)
+			}
+			if len(missing) != len(tt.missing) || readiness.Ready != (len(tt.missing) == 0) {
+				t.Fatalf("readiness = %+v, want missing %v", readiness, tt.missing)
+			}
+			for i := range missing {
+				if missing[i] != tt.missing[i] {
+					t.Errorf("missing[%d] = %q, want %q", i, missing[i], tt.missing[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadinessPath(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *Config
+		want string
+	}{
+		{"server PATH", &Config{}, os.Getenv("PATH")},
+		{"config PATH", &Config{EnvironmentVariables: map[string]string{"PATH": "/config/bin"}}, "/config/bin"},
+		{"default profile wins over config", &Config{
+			EnvironmentVariables: map[string]string{"PATH": "/config/bin"},
+			DefaultProfile:       "dev",
+			Profiles:             map[string]Profile{"dev": {Variables: map[string]string{"PATH": "/dev/bin"}}},
+		}, "/dev/bin"},
+		{"unknown default profile is ignored", &Config{
+			EnvironmentVariables: map[string]string{"PATH": "/config/bin"},
+			DefaultProfile:       "missing",
+		}, "/config/bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readinessPath(tt.cfg, &Script{}); got != tt.want {
+				t.Errorf("readinessPath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Profile is a named set of variables (e.g. dev, staging, prod) applied to a run.
+type Profile struct {
+	Variables map[string]string `json:"variables,omitempty"`
+	// Secrets maps variable names to secret references ("env:NAME" or "file:/path").
+	// References are resolved at run time and their values are never stored in history.
+	Secrets map[string]string `json:"secrets,omitempty"`
+}
+
+// resolveProfile returns the profile selected for a run, falling back to the
+// configured default. An empty name with no default means no profile.
+func resolveProfile(cfg *Config, requested string) (string, *Profile, error) {
+	name := strings.TrimSpace(requested)
+	if name == "" {
+		name = cfg.DefaultProfile
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return name, nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return name, &profile, nil
+}
+
+// profileAllowed reports whether a script may run under the given profile.
+// Scripts without an @profiles allow-list run under any profile. Names match
+// exactly, like the profile names in the config.
+func profileAllowed(script *Script, name string) bool {
+	if len(script.Profiles) == 0 {
+		return true
+	}
+	for _, p := range script.Profiles {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecrets resolves every secret reference of the profile into its value.
+func (p *Profile) resolveSecrets() (map[string]string, error) {
+	values := make(map[string]string, len(p.Secrets))
+	for name, ref := range p.Secrets {
+		value, err := resolveSecretRef(ref)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func resolveSecretRef(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		value, ok := os.LookupEnv(strings.TrimPrefix(ref, "env:"))
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", strings.TrimPrefix(ref, "env:"))
+		}
+		return value, nil
+	case strings.HasPrefix(ref, "file:"):
+		data, err := os.ReadFile(expandHome(strings.TrimPrefix(ref, "file:")))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("unsupported secret reference %q", ref)
+	}
+}
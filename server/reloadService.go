@@ -0,0 +1,328 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hasNameMetadata reports whether content declares a script name, used when
+// the config only registers files that opt in with metadata.
+func hasNameMetadata(path, content, comment string) bool {
+	_, ok := parseMetadata(path, content, comment).seen["name"]
+	return ok
+}
+
+// hasMetadata reports whether a text file declares any metadata, used to
+// register extension-less executables.
+func hasMetadata(path, content, comment string) bool {
+	if strings.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+		return false // binary
+	}
+	return len(parseMetadata(path, content, comment).seen) > 0
+}
+
+// readinessRefresh throttles refreshReadiness: watcher reloads can follow
+// each other quickly, and each check stats every required tool.
+var readinessRefresh struct {
+	sync.Mutex
+	last time.Time
+}
+
+// readinessRefreshInterval is the least time between two refreshes of
+// scripts that were not re-parsed, unless a full reload forces one.
+const readinessRefreshInterval = time.Minute
+
+// refreshReadiness re-checks the @requires of stored scripts that were not
+// re-parsed, since tools are installed and removed independently of scripts.
+// It runs after a reload releases reloadMu and is skipped while another
+// refresh is running or, unless force is set, when the last one is recent.
+func refreshReadiness(cfg *Config, parsed []*Script, force bool) {
+	if !readinessRefresh.TryLock() {
+		return
+	}
+	defer readinessRefresh.Unlock()
+	if !force && time.Since(readinessRefresh.last) < readinessRefreshInterval {
+		return
+	}
+	readinessRefresh.last = time.Now()
+
+	skip := make(map[string]struct{}, len(parsed))
+	for _, script := range parsed {
+		skip[script.ID] = struct{}{}
+	}
+	scripts, err := storage.ListScripts(ScriptQuery{Limit: -1})
+	if err != nil {
+		log.Printf("refresh readiness: %v", err)
+		return
+	}
+	for _, script := range scripts {
+		if _, ok := skip[script.ID]; ok || len(script.Requires) == 0 {
+			continue
+		}
+		if err := storage.SetReadiness(script.ID, checkRequirements(script.Requires, readinessPath(cfg, script))); err != nil {
+			log.Printf("refresh readiness of %s: %v", script.ID, err)
+		}
+	}
+}
+
+// reloadMu serializes reloads triggered by the API and the file watcher.
+var reloadMu sync.Mutex
+
+// ScriptChanges is the set of storage updates produced by a reload.
+type ScriptChanges struct {
+	Save   []*Script
+	Delete []string
+	// Touch refreshes the stored size and mtime of files whose content did not change.
+	Touch  []ScriptIdentity
+	Relink []IdentityMigration
+}
+
+// ScriptChange names a script in a reload report.
+type ScriptChange struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// ReloadReport is the diff between the catalog before and after a reload.
+type ReloadReport struct {
+	Count      int                 `json:"count"`
+	Added      []ScriptChange      `json:"added"`
+	Updated    []ScriptChange      `json:"updated"`
+	Removed    []ScriptChange      `json:"removed"`
+	Unchanged  []ScriptChange      `json:"unchanged"`
+	Migrations []IdentityMigration `json:"migrations"`
+	Errors     int                 `json:"errors"` // scripts with at least one error diagnostic
+}
+
+func (r *ReloadReport) counts() map[string]int {
+	return map[string]int{
+		"added":     len(r.Added),
+		"updated":   len(r.Updated),
+		"removed":   len(r.Removed),
+		"unchanged": len(r.Unchanged),
+	}
+}
+
+// changed reports whether the reload modified the catalog.
+func (r *ReloadReport) changed() bool {
+	return len(r.Added)+len(r.Updated)+len(r.Removed) > 0
+}
+
+// inFolders reports whether path lies in one of folders.
+func inFolders(path string, folders []string) bool {
+	for _, folder := range folders {
+		if rel, err := filepath.Rel(folder, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadScripts scans the given folders plus the configured script folders and
+// brings storage in line with them. Files whose size and mtime (or content hash)
+// match the stored state are not re-parsed unless their row was stored by an
+// older scriptParserVersion, rows are deleted only for files that
+// disappeared from the scanned folders, so scripts loaded from other folders
+// survive a reload of the configured ones, and all updates are applied in one
+// transaction so the catalog is never observed half-loaded. full forces every
+// file to be re-parsed.
+func reloadScripts(folders []string, full bool) (*ReloadReport, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, errors.New("failed to load config")
+	}
+	folderSet := make(map[string]struct{})
+	var allFolders []string
+	for _, f := range append(append([]string{}, folders...), cfg.ScriptFolders...) {
+		f = expandHome(f)
+		if _, ok := folderSet[f]; ok {
+			continue
+		}
+		folderSet[f] = struct{}{}
+		allFolders = append(allFolders, f)
+	}
+
+	previous, err := storage.ListScriptIdentities()
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string][]ScriptIdentity)
+	for _, identity := range previous {
+		byPath[identity.Path] = append(byPath[identity.Path], identity)
+	}
+
+	report := &ReloadReport{
+		Added:     []ScriptChange{},
+		Updated:   []ScriptChange{},
+		Removed:   []ScriptChange{},
+		Unchanged: []ScriptChange{},
+	}
+	changes := &ScriptChanges{}
+	var current []ScriptIdentity
+	seen := make(map[string]struct{})
+	keep := func(stored []ScriptIdentity) {
+		for _, identity := range stored {
+			current = append(current, identity)
+			report.Unchanged = append(report.Unchanged, ScriptChange{ID: identity.ID, Name: identity.Name, Path: identity.Path})
+		}
+	}
+
+	for _, folder := range allFolders {
+		walker := newScriptWalker(folder, cfg)
+		err := walker.walk(folder, func(path string, d fs.DirEntry) error {
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			// Project files are registered through their task provider. Files without
+			// a registered extension are only considered when they are extension-less
+			// executables, and registered if they carry metadata
+			provider := cfg.taskProviderFor(path)
+			_, known := cfg.languageFor(path)
+			if provider == nil && !known && (filepath.Ext(path) != "" || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0) {
+				return nil
+			}
+			if _, ok := seen[path]; ok {
+				return nil
+			}
+			stored := byPath[path]
+			size, modTime := info.Size(), info.ModTime().UnixNano()
+			// Rows stored by an older parser are re-parsed like changed files
+			fresh := !full && len(stored) > 0 && stored[0].ParserVersion == scriptParserVersion
+			if fresh && stored[0].Size == size && stored[0].ModTime == modTime {
+				seen[path] = struct{}{}
+				keep(stored)
+				return nil
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				// Keep what is stored rather than dropping a file that is briefly unreadable
+				seen[path] = struct{}{}
+				keep(stored)
+				return nil
+			}
+			var scripts []*Script
+			if provider != nil {
+				if scripts, err = provider.parse(path, string(content)); err != nil {
+					log.Printf("%s: %v", path, err)
+					seen[path] = struct{}{}
+					keep(stored)
+					return nil
+				}
+			} else {
+				comment := cfg.commentFor(path, string(content))
+				if !known && !hasMetadata(path, string(content), comment) {
+					return nil
+				}
+				if cfg.RequireMetadata && !hasNameMetadata(path, string(content), comment) {
+					return nil
+				}
+				fingerprint := contentFingerprint(string(content))
+				if fresh && stored[0].Fingerprint == fingerprint {
+					seen[path] = struct{}{}
+					for _, identity := range stored {
+						identity.Size, identity.ModTime = size, modTime
+						changes.Touch = append(changes.Touch, identity)
+					}
+					keep(stored)
+					return nil
+				}
+				script, err := parseScript(path, string(content), comment)
+				if err != nil {
+					log.Printf("parseScript err: %v", err)
+					return nil
+				}
+				if cfg.SearchScriptContent {
+					script.content = string(content)
+				}
+				scripts = []*Script{script}
+			}
+			seen[path] = struct{}{}
+
+			storedByID := make(map[string]ScriptIdentity, len(stored))
+			for _, identity := range stored {
+				storedByID[identity.ID] = identity
+			}
+			ids := make(map[string]struct{}, len(scripts))
+			for _, script := range scripts {
+				if script.Category == "" {
+					script.Category = "uncategorized"
+				}
+				script.size, script.modTime = size, modTime
+				if len(script.Requires) > 0 {
+					script.Readiness = checkRequirements(script.Requires, readinessPath(cfg, script))
+				}
+				ids[script.ID] = struct{}{}
+				changes.Save = append(changes.Save, script)
+				current = append(current, ScriptIdentity{ID: script.ID, Name: script.Name, Path: path, Fingerprint: script.Fingerprint, Size: size, ModTime: modTime})
+
+				entry := ScriptChange{ID: script.ID, Name: script.Name, Path: path}
+				previous, found := storedByID[script.ID]
+				switch {
+				case len(stored) == 0 || (provider != nil && !found):
+					report.Added = append(report.Added, entry)
+				case found && previous.Fingerprint == script.Fingerprint:
+					// Re-parsed by a full reload without any change to the file
+					report.Unchanged = append(report.Unchanged, entry)
+				default:
+					report.Updated = append(report.Updated, entry)
+				}
+			}
+			for _, identity := range stored {
+				if _, ok := ids[identity.ID]; ok {
+					continue
+				}
+				changes.Delete = append(changes.Delete, identity.ID)
+				if provider != nil {
+					// A target removed from its project file
+					report.Removed = append(report.Removed, ScriptChange{ID: identity.ID, Name: identity.Name, Path: identity.Path})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			continue
+		}
+	}
+
+	for path, stored := range byPath {
+		if _, ok := seen[path]; ok {
+			continue
+		}
+		if !inFolders(path, allFolders) {
+			current = append(current, stored...)
+			continue
+		}
+		for _, identity := range stored {
+			changes.Delete = append(changes.Delete, identity.ID)
+			report.Removed = append(report.Removed, ScriptChange{ID: identity.ID, Name: identity.Name, Path: identity.Path})
+		}
+	}
+
+	claimScriptIDs(previous, current, changes.Save, report)
+	changes.Relink = relinkScripts(previous, current)
+	if err := storage.ApplyScriptChanges(changes); err != nil {
+		return nil, err
+	}
+	report.Count = len(current)
+	report.Migrations = changes.Relink
+	if report.Errors, err = storage.CountScriptsWithErrors(); err != nil {
+		log.Printf("count script errors: %v", err)
+	}
+	go refreshReadiness(cfg, changes.Save, full)
+	return report, nil
+}
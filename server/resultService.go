@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// resultEnv names the file a script may write its JSON result to.
+const resultEnv = "DEVLOOP_RESULT"
+
+// maxResultSize bounds the result file read back after a run.
+const maxResultSize = 1 << 20
+
+// newResultFile creates the empty file a run writes its result to.
+func newResultFile() (string, error) {
+	f, err := os.CreateTemp("", "devloop-result-*.json")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// readResult reads the result a script wrote to path and checks it against
+// schema. A script that wrote nothing has no result. The returned error
+// message is stored with the result rather than failing the run.
+func readResult(path string, schema json.RawMessage) (json.RawMessage, string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 {
+		return nil, ""
+	}
+	if info.Size() > maxResultSize {
+		return nil, fmt.Sprintf("result is %d bytes, larger than the %d byte limit", info.Size(), maxResultSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err.Error()
+	}
+	data = bytes.TrimSpace(data)
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, "result is not valid JSON: " + err.Error()
+	}
+	// Store the result compacted
+	var compact bytes.Buffer
+	if json.Compact(&compact, data) == nil {
+		data = compact.Bytes()
+	}
+	if len(schema) == 0 {
+		return data, ""
+	}
+	var s map[string]interface{}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return data, "invalid @output-schema: " + err.Error()
+	}
+	if problems := validateJSON(s, value, "$"); len(problems) > 0 {
+		return data, "result does not match @output-schema: " + strings.Join(problems, "; ")
+	}
+	return data, ""
+}
+
+// schemaTypes are the JSON Schema types validateJSON understands.
+var schemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// checkSchema reports problems in a schema that validateJSON would trip over:
+// unknown types, misshapen keywords and patterns that do not compile.
+func checkSchema(schema map[string]interface{}) error {
+	for _, t := range schemaTypeList(schema["type"]) {
+		if !containsString(schemaTypes, t) {
+			return fmt.Errorf("unknown type %q", t)
+		}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("pattern: %v", err)
+		}
+	}
+	if required, ok := schema["required"]; ok {
+		list, ok := required.([]interface{})
+		if !ok {
+			return fmt.Errorf("required must be a list of property names")
+		}
+		for _, name := range list {
+			if _, ok := name.(string); !ok {
+				return fmt.Errorf("required must be a list of property names")
+			}
+		}
+	}
+	if properties, ok := schema["properties"]; ok {
+		props, ok := properties.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("properties must be an object")
+		}
+		for name, sub := range props {
+			subSchema, ok := sub.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("property %s must be a schema", name)
+			}
+			if err := checkSchema(subSchema); err != nil {
+				return fmt.Errorf("property %s: %w", name, err)
+			}
+		}
+	}
+	for _, key := range []string{"items", "additionalProperties"} {
+		if sub, ok := schema[key].(map[string]interface{}); ok {
+			if err := checkSchema(sub); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func schemaTypeList(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// validateJSON checks a decoded JSON value against a subset of JSON Schema:
+// type, enum, const, properties, required, additionalProperties, items,
+// minItems, maxItems, minLength, maxLength, pattern, minimum and maximum.
+// It returns one message per problem, located by a path such as $.items[0].
+func validateJSON(schema map[string]interface{}, value interface{}, path string) []string {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := schemaTypeList(schema["type"]); len(types) > 0 {
+		actual := jsonType(value)
+		ok := false
+		for _, t := range types {
+			if t == actual || t == "number" && actual == "integer" {
+				ok = true
+			}
+		}
+		if !ok {
+			fail("expected %s, got %s", strings.Join(types, " or "), actual)
+			return problems
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !containsJSON(enum, value) {
+		fail("must be one of %s", mustJSON(enum))
+	}
+	if constant, ok := schema["const"]; ok && !containsJSON([]interface{}{constant}, value) {
+		fail("must be %s", mustJSON(constant))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, present := v[key]; !present {
+						fail("missing required property %q", key)
+					}
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if sub, ok := properties[key].(map[string]interface{}); ok {
+				problems = append(problems, validateJSON(sub, v[key], path+"."+key)...)
+				continue
+			}
+			if _, declared := properties[key]; declared {
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					fail("unexpected property %q", key)
+				}
+			case map[string]interface{}:
+				problems = append(problems, validateJSON(additional, v[key], path+"."+key)...)
+			}
+		}
+	case []interface{}:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			fail("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			fail("expected at most %v items, got %d", n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateJSON(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			fail("expected at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			fail("expected at most %v characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				fail("does not match pattern %q", pattern)
+			}
+		}
+	case float64:
+		if n, ok := schemaNumber(schema, "minimum"); ok && v < n {
+			fail("must be at least %v", n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && v > n {
+			fail("must be at most %v", n)
+		}
+	}
+	return problems
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func containsJSON(values []interface{}, value interface{}) bool {
+	encoded := mustJSON(value)
+	for _, v := range values {
+		if mustJSON(v) == encoded {
+			return true
+		}
+	}
+	return false
+}
+
+func mustJSON(v interface{}) string {
+	encoded, _ := json.Marshal(v)
+	return string(encoded)
+}
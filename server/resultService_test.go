@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   []string
+	}{
+		{"type matches", `{"type": "string"}`, `"x"`, nil},
+		{"type mismatch stops", `{"type": "string", "minLength": 3}`, `1`, []string{"$: expected string, got integer"}},
+		{"integer is a number", `{"type": "number"}`, `3`, nil},
+		{"fraction is not an integer", `{"type": "integer"}`, `3.5`, []string{"$: expected integer, got number"}},
+		{"type list", `{"type": ["string", "null"]}`, `null`, nil},
+		{"enum", `{"enum": ["a", "b"]}`, `"c"`, []string{`$: must be one of ["a","b"]`}},
+		{"const object", `{"const": {"a": 1}}`, `{"a": 1}`, nil},
+		{"required and nested properties", `{"type": "object", "required": ["ok", "count"], "properties": {"ok": {"type": "boolean"}, "count": {"type": "integer", "minimum": 0}}}`, `{"ok": "yes"}`,
+			[]string{`$: missing required property "count"`, "$.ok: expected boolean, got string"}},
+		{"additional properties forbidden", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"a": 1, "b": 2, "c": 3}`,
+			[]string{`$: unexpected property "b"`, `$: unexpected property "c"`}},
+		{"additional properties schema", `{"additionalProperties": {"type": "number"}}`, `{"a": 1, "b": "x"}`, []string{"$.b: expected number, got string"}},
+		{"declared property without schema", `{"properties": {"a": true}, "additionalProperties": false}`, `{"a": 1}`, nil},
+		{"array bounds and items", `{"minItems": 2, "maxItems": 3, "items": {"type": "string"}}`, `[1]`,
+			[]string{"$: expected at least 2 items, got 1", "$[0]: expected string, got integer"}},
+		{"array too long", `{"maxItems": 1}`, `[1, 2]`, []string{"$: expected at most 1 items, got 2"}},
+		{"string length counts runes", `{"maxLength": 2}`, `"éé"`, nil},
+		{"string too short", `{"minLength": 2}`, `"a"`, []string{"$: expected at least 2 characters"}},
+		{"pattern", `{"pattern": "^v[0-9]+$"}`, `"1.0"`, []string{`$: does not match pattern "^v[0-9]+$"`}},
+		{"number bounds", `{"minimum": 1, "maximum": 10}`, `11`, []string{"$: must be at most 10"}},
+		{"deep path", `{"properties": {"items": {"items": {"required": ["id"]}}}}`, `{"items": [{"id": 1}, {}]}`, []string{`$.items[1]: missing required property "id"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]interface{}
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			if got := validateJSON(schema, value, "$"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateJSON(%s, %s) = %q, want %q", tt.schema, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	tests := []struct {
+		schema  string
+		wantErr string
+	}{
+		{`{"type": "object", "properties": {"a": {"type": ["string", "null"]}}, "required": ["a"]}`, ""},
+		{`{"type": "text"}`, `unknown type "text"`},
+		{`{"pattern": "("}`, "pattern:"},
+		{`{"required": "a"}`, "required must be a list"},
+		{`{"required": [1]}`, "required must be a list"},
+		{`{"properties": []}`, "properties must be an object"},
+		{`{"properties": {"a": 1}}`, "property a must be a schema"},
+		{`{"properties": {"a": {"type": "float"}}}`, "property a: unknown type"},
+		{`{"items": {"type": "float"}}`, "items: unknown type"},
+		{`{"additionalProperties": {"type": "float"}}`, "additionalProperties: unknown type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			var schema map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			err := checkSchema(schema)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkSchema = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkSchema = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		schema    string
+		want      string
+		wantError string
+	}{
+		{"no result", "", "", "", ""},
+		{"compacted", "{\n  \"ok\": true\n}\n", "", `{"ok":true}`, ""},
+		{"invalid JSON", "{", "", "", "result is not valid JSON"},
+		{"matches schema", `{"ok": true}`, `{"required": ["ok"]}`, `{"ok":true}`, ""},
+		{"kept when it does not match", `{}`, `{"required": ["ok"]}`, `{}`, "result does not match @output-schema"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "result.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, problem := readResult(path, json.RawMessage(tt.schema))
+			if string(got) != tt.want {
+				t.Errorf("result = %s, want %s", got, tt.want)
+			}
+			if tt.wantError == "" && problem != "" || !strings.Contains(problem, tt.wantError) {
+				t.Errorf("error = %q, want %q", problem, tt.wantError)
+			}
+		})
+	}
+}
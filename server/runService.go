@@ -0,0 +1,108 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startPiped starts a resolved execution in the background with its stdin
+// kept open, and registers it as job j, which clients write to with
+// writeStdinHandler and follow with attachHandler. stdin is written first.
+func startPiped(j *job, run *execution, stdin string, onExit func(exitCode int)) error {
+	cmd := exec.Command(run.argv[0], run.argv[1:]...)
+	cmd.Dir = run.dir
+	cmd.Env = run.environ()
+	// Do not wait for a background child that keeps the output pipes open
+	cmd.WaitDelay = outputDrainTimeout
+	input, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	j.input = input
+	j.closeIn = input.Close
+	cmd.Stdout = j
+	cmd.Stderr = j
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	if stdin != "" {
+		j.writeInitialInput([]byte(stdin))
+	}
+	jobs.add(j)
+	go func() {
+		exitCode := 0
+		if err := cmd.Wait(); errors.Is(err, exec.ErrWaitDelay) {
+			exitCode = cmd.ProcessState.ExitCode() // exited; only a child held the pipes
+		} else if err != nil {
+			exitCode = -1
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				exitCode = exitErr.ExitCode()
+			}
+		}
+		onExit(exitCode)
+		j.finish(exitCode)
+		jobs.remove(j.ID)
+	}()
+	return nil
+}
+
+// RunInfo describes a background run that is still in progress.
+type RunInfo struct {
+	ID        string    `json:"id"` // history ID the run is saved under
+	ScriptID  string    `json:"script_id"`
+	StartedAt time.Time `json:"started_at"`
+	TTY       bool      `json:"tty"`
+}
+
+func (r *jobRegistry) list() []RunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := make([]RunInfo, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		runs = append(runs, RunInfo{ID: j.ID, ScriptID: j.ScriptID, StartedAt: j.StartedAt, TTY: j.TTY})
+	}
+	sort.Slice(runs, func(a, b int) bool { return runs[a].StartedAt.Before(runs[b].StartedAt) })
+	return runs
+}
+
+func listRunsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, jobs.list())
+}
+
+// writeStdinHandler writes the request body to the stdin of a running job,
+// then closes stdin when ?close=true.
+func writeStdinHandler(c *gin.Context) {
+	j := jobs.get(c.Param("id"))
+	if j == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "run not found or already finished"})
+		return
+	}
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+	written := 0
+	if len(data) > 0 {
+		if written, err = j.writeInput(data); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "stdin is closed: " + err.Error(), "written": written})
+			return
+		}
+	}
+	closed := c.Query("close") == "true"
+	if closed {
+		if err := j.closeInput(); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "failed to close stdin: " + err.Error(), "written": written})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"written": written, "closed": closed})
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBackgroundRunEndsWithProcess checks that a run whose background child
+// keeps its output open ends when the process exits, not when the child does.
+func TestBackgroundRunEndsWithProcess(t *testing.T) {
+	for _, tty := range []bool{false, true} {
+		name := "piped"
+		if tty {
+			name = "tty"
+		}
+		t.Run(name, func(t *testing.T) {
+			run := &execution{argv: []string{"sh", "-c", "sleep 10 & echo started"}, dir: t.TempDir()}
+			spool := newOutputSpool(OutputLimits{SpoolBytes: 4096, PreviewBytes: 100}, "")
+			j := newJob("test-"+name, "script", spool)
+			exited := make(chan int, 1)
+			onExit := func(exitCode int) { exited <- exitCode }
+			var err error
+			if tty {
+				err = startTTY(j, run, 0, 0, "", onExit)
+			} else {
+				err = startPiped(j, run, "", onExit)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case exitCode := <-exited:
+				if exitCode != 0 {
+					t.Errorf("exit code = %d, want 0", exitCode)
+				}
+			case <-time.After(outputDrainTimeout + 3*time.Second):
+				t.Fatal("run did not end with its process")
+			}
+			if out := spool.String(); !strings.Contains(out, "started") {
+				t.Errorf("output = %q, want the process output", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PackageIndex points dependency installs at a local mirror or cache.
+type PackageIndex struct {
+	PipIndexURL  string `json:"pipIndexUrl,omitempty"`
+	PipFindLinks string `json:"pipFindLinks,omitempty"` // folder or URL of wheels, defaults to ~/.dev-loop/envs/wheels when it exists
+	NpmRegistry  string `json:"npmRegistry,omitempty"`
+	Offline      bool   `json:"offline,omitempty"` // install only from the local wheels folder and npm cache
+}
+
+// readyMarker is written into an environment once its install succeeded.
+const readyMarker = ".devloop-ready"
+
+// envLocks serializes setup of the same environment by concurrent runs.
+var envLocks sync.Map
+
+// ScriptEnv is the isolated environment a script runs in.
+type ScriptEnv struct {
+	Python      string            // venv interpreter replacing python on the command line
+	Env         map[string]string // variables added to the process environment
+	Dirs        []string          // environment folders under ~/.dev-loop/envs
+	PathEntries []string          // folders prepended to PATH
+}
+
+// envDir returns the environment folder for a dependency list, keyed by the
+// kind, the toolchain version and the sorted list so scripts with the same
+// dependencies share one environment.
+func envDir(kind, version string, deps []string) string {
+	sorted := append([]string{}, deps...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(kind + "\x00" + version + "\x00" + strings.Join(sorted, "\n")))
+	return filepath.Join(getConfigFolderPath(), "envs", kind, hex.EncodeToString(sum[:])[:16])
+}
+
+// toolVersion returns the version of a tool on the server's PATH. It is
+// probed with a timeout and cached by the binary like @requires checks, so
+// reloads and runs do not spawn the tool each time.
+func toolVersion(tool string) (string, error) {
+	path, err := lookPathIn(tool, os.Getenv("PATH"))
+	if err != nil {
+		return "", fmt.Errorf("%s is not available: %w", tool, err)
+	}
+	return toolVersionAt(tool, path)
+}
+
+// pythonCommand returns the system interpreter used to create virtualenvs.
+func pythonCommand() string {
+	for _, name := range []string{"python3", "python"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return "python3"
+}
+
+// venvBin returns the executables folder of a virtualenv.
+func venvBin(dir string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, "Scripts")
+	}
+	return filepath.Join(dir, "bin")
+}
+
+// setupEnv creates an environment with create unless it is already marked
+// ready. A failed setup is removed so the next run starts over.
+func setupEnv(dir string, log *strings.Builder, create func() error) error {
+	lock, _ := envLocks.LoadOrStore(dir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if _, err := os.Stat(filepath.Join(dir, readyMarker)); err == nil {
+		fmt.Fprintf(log, "using environment %s\n", dir)
+		return nil
+	}
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fmt.Fprintf(log, "creating environment %s\n", dir)
+	if err := create(); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, readyMarker), nil, 0644)
+}
+
+// runSetup runs a setup command, appending the command and its output to log.
+func runSetup(log *strings.Builder, dir string, name string, args ...string) error {
+	fmt.Fprintf(log, "$ %s %s\n", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	cmd.Stdout, cmd.Stderr = log, log
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", filepath.Base(name), err)
+	}
+	return nil
+}
+
+// prepareScriptEnv makes sure the virtualenv and node_modules declared by a
+// script's @requirements and @dependencies exist under ~/.dev-loop/envs,
+// installing them on first use. The returned log describes the setup phase.
+func prepareScriptEnv(cfg *Config, script *Script) (*ScriptEnv, string, error) {
+	env := &ScriptEnv{Env: map[string]string{}}
+	var log strings.Builder
+
+	if len(script.Requirements) > 0 {
+		python := pythonCommand()
+		version, err := toolVersion(python)
+		if err != nil {
+			return nil, log.String(), err
+		}
+		dir := envDir("python", version, script.Requirements)
+		err = setupEnv(dir, &log, func() error {
+			if err := runSetup(&log, dir, python, "-m", "venv", dir); err != nil {
+				return err
+			}
+			args := []string{"-m", "pip", "install", "--disable-pip-version-check", "--no-input"}
+			switch {
+			case cfg.PackageIndex.Offline:
+				args = append(args, "--no-index")
+			case cfg.PackageIndex.PipIndexURL != "":
+				args = append(args, "--index-url", cfg.PackageIndex.PipIndexURL)
+			}
+			findLinks := cfg.PackageIndex.PipFindLinks
+			if findLinks == "" {
+				if wheels := filepath.Join(getConfigFolderPath(), "envs", "wheels"); isDir(wheels) {
+					findLinks = wheels
+				}
+			}
+			if findLinks != "" {
+				args = append(args, "--find-links", expandHome(findLinks))
+			}
+			return runSetup(&log, dir, filepath.Join(venvBin(dir), "python"), append(args, script.Requirements...)...)
+		})
+		if err != nil {
+			return nil, log.String(), err
+		}
+		env.Python = filepath.Join(venvBin(dir), "python")
+		env.Env["VIRTUAL_ENV"] = dir
+		env.Dirs = append(env.Dirs, dir)
+		env.PathEntries = append(env.PathEntries, venvBin(dir))
+	}
+
+	if len(script.Dependencies) > 0 {
+		version, err := toolVersion("node")
+		if err != nil {
+			return nil, log.String(), err
+		}
+		dir := envDir("node", version, script.Dependencies)
+		err = setupEnv(dir, &log, func() error {
+			if err := os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name": "dev-loop-env", "private": true}`+"\n"), 0644); err != nil {
+				return err
+			}
+			// --prefer-offline installs from the npm cache when it has the packages
+			args := []string{"install", "--no-audit", "--no-fund", "--prefer-offline"}
+			if cfg.PackageIndex.Offline {
+				args = append(args, "--offline")
+			}
+			if cfg.PackageIndex.NpmRegistry != "" {
+				args = append(args, "--registry", cfg.PackageIndex.NpmRegistry)
+			}
+			return runSetup(&log, dir, "npm", append(args, script.Dependencies...)...)
+		})
+		if err != nil {
+			return nil, log.String(), err
+		}
+		// NODE_PATH resolves require(); ES module imports do not consult it
+		env.Env["NODE_PATH"] = filepath.Join(dir, "node_modules")
+		env.Dirs = append(env.Dirs, dir)
+		env.PathEntries = append(env.PathEntries, filepath.Join(dir, "node_modules", ".bin"))
+	}
+	return env, log.String(), nil
+}
+
+// preparedPathEntries returns the PATH folders of the environments a run of
+// the script would use, for those already installed. Nothing is installed.
+func preparedPathEntries(script *Script) []string {
+	var entries []string
+	if len(script.Requirements) > 0 {
+		if version, err := toolVersion(pythonCommand()); err == nil {
+			if dir := envDir("python", version, script.Requirements); isReady(dir) {
+				entries = append(entries, venvBin(dir))
+			}
+		}
+	}
+	if len(script.Dependencies) > 0 {
+		if version, err := toolVersion("node"); err == nil {
+			if dir := envDir("node", version, script.Dependencies); isReady(dir) {
+				entries = append(entries, filepath.Join(dir, "node_modules", ".bin"))
+			}
+		}
+	}
+	return entries
+}
+
+func isReady(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, readyMarker))
+	return err == nil
+}
+
+// apply points a command line and process environment at the environment.
+func (e *ScriptEnv) apply(commandParts []string, processEnv map[string]string) {
+	if e.Python != "" && len(commandParts) > 0 && strings.HasPrefix(filepath.Base(commandParts[0]), "python") {
+		commandParts[0] = e.Python
+	}
+	for k, v := range e.Env {
+		processEnv[k] = v
+	}
+	if len(e.PathEntries) > 0 {
+		path, ok := processEnv["PATH"]
+		if !ok {
+			path = os.Getenv("PATH")
+		}
+		processEnv["PATH"] = strings.Join(append(append([]string{}, e.PathEntries...), path), string(os.PathListSeparator))
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,432 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic describes a problem found while parsing script metadata.
+type Diagnostic struct {
+	Line     int    `json:"line"`
+	Key      string `json:"key,omitempty"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// runners are the accepted values of @runner: "interpreter" runs the script
+// through its language interpreter, "shebang" executes the file directly.
+var runners = []string{runnerInterpreter, runnerShebang}
+
+const (
+	runnerInterpreter = "interpreter"
+	runnerShebang     = "shebang"
+)
+
+// scriptParserVersion is stored with every script. Bump it whenever parsing
+// changes what is stored, so the next reload re-parses files that did not
+// change on disk instead of keeping rows without the new fields.
+const scriptParserVersion = 2
+
+// scriptIDRe matches the ids a script may declare with @id; they are used
+// in URLs such as /api/scripts/:id.
+var scriptIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// inputTypes are the input types the UI knows how to render.
+var inputTypes = map[string]struct{}{"string": {}, "number": {}, "boolean": {}, "file": {}, "select": {}}
+
+// metadataEntry is a single metadata key and value and the line it starts on.
+type metadataEntry struct {
+	key   string
+	value string
+	line  int
+	node  *yaml.Node // set when the entry comes from a YAML block
+}
+
+// scriptParser collects metadata and diagnostics for one script.
+type scriptParser struct {
+	script *Script
+	seen   map[string]int // key -> first line, to report duplicates
+}
+
+func (p *scriptParser) report(line int, key, severity, format string, args ...interface{}) {
+	p.script.Diagnostics = append(p.script.Diagnostics, Diagnostic{
+		Line:     line,
+		Key:      key,
+		Message:  fmt.Sprintf(format, args...),
+		Severity: severity,
+	})
+}
+
+// unmarshal decodes a JSON or YAML metadata value, reporting an error
+// diagnostic on failure.
+func (p *scriptParser) unmarshal(entry metadataEntry, v interface{}) bool {
+	if entry.node != nil {
+		if err := entry.node.Decode(v); err != nil {
+			p.report(entry.line, entry.key, severityError, "invalid value: %s", strings.TrimPrefix(err.Error(), "yaml: "))
+			return false
+		}
+		return true
+	}
+	if err := json.Unmarshal([]byte(entry.value), v); err != nil {
+		p.report(entry.line, entry.key, severityError, "invalid JSON: %v", err)
+		return false
+	}
+	return true
+}
+
+// list decodes a list value given as JSON, YAML or separated by commas, and
+// also by spaces unless commaOnly is set: "requests==2.31 rich".
+func (p *scriptParser) list(entry metadataEntry, v *[]string, commaOnly bool) {
+	if entry.node != nil || strings.HasPrefix(entry.value, "[") {
+		p.unmarshal(entry, v)
+		return
+	}
+	*v = nil
+	for _, item := range strings.FieldsFunc(entry.value, func(r rune) bool {
+		return r == ',' || !commaOnly && (r == ' ' || r == '\t')
+	}) {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+}
+
+func (p *scriptParser) apply(entry metadataEntry) {
+	script := p.script
+	if first, ok := p.seen[entry.key]; ok {
+		p.report(entry.line, entry.key, severityWarning, "duplicate key, already set on line %d", first)
+	} else {
+		p.seen[entry.key] = entry.line
+	}
+	if entry.node != nil && entry.node.Kind != yaml.ScalarNode {
+		switch entry.key {
+		case "tags", "profiles", "inputs", "requirements", "dependencies", "requires", "output-schema":
+		default:
+			p.report(entry.line, entry.key, severityError, "expected a single value")
+			return
+		}
+	}
+	switch entry.key {
+	case "id":
+		if !scriptIDRe.MatchString(entry.value) || entry.value == "." || entry.value == ".." {
+			p.report(entry.line, entry.key, severityError, "invalid id %q, expected letters, digits, '.', '_' or '-'", entry.value)
+			return
+		}
+		script.ID = entry.value
+		script.idLine = entry.line
+	case "name":
+		script.Name = entry.value
+	case "description":
+		script.Description = entry.value
+	case "author":
+		script.Author = entry.value
+	case "category":
+		script.Category = entry.value
+	case "tags":
+		p.unmarshal(entry, &script.Tags)
+	case "profiles":
+		p.unmarshal(entry, &script.Profiles)
+	case "confirm":
+		script.Confirm = entry.value
+	case "danger":
+		script.Danger = strings.ToLower(entry.value)
+		if !containsString(dangerLevels, script.Danger) {
+			p.report(entry.line, entry.key, severityWarning, "unknown danger level %q, expected one of %s; it will require confirmation like critical", entry.value, strings.Join(dangerLevels, ", "))
+		}
+	case "requirements":
+		p.list(entry, &script.Requirements, false)
+	case "dependencies":
+		p.list(entry, &script.Dependencies, false)
+	case "requires":
+		p.list(entry, &script.Requires, true)
+		for _, requirement := range script.Requires {
+			if _, err := parseRequirement(requirement); err != nil {
+				p.report(entry.line, entry.key, severityError, "%v", err)
+			}
+		}
+	case "tty":
+		tty, err := strconv.ParseBool(entry.value)
+		if err != nil {
+			p.report(entry.line, entry.key, severityError, "expected true or false")
+			return
+		}
+		script.TTY = tty
+	case "output-schema":
+		var schema map[string]interface{}
+		if !p.unmarshal(entry, &schema) {
+			return
+		}
+		if err := checkSchema(schema); err != nil {
+			p.report(entry.line, entry.key, severityError, "invalid schema: %v", err)
+			return
+		}
+		script.OutputSchema, _ = json.Marshal(schema)
+	case "runner":
+		script.Runner = strings.ToLower(entry.value)
+		if !containsString(runners, script.Runner) {
+			p.report(entry.line, entry.key, severityWarning, "unknown runner %q, expected one of %s", entry.value, strings.Join(runners, ", "))
+		}
+	case "inputs":
+		var inputs []Input
+		if !p.unmarshal(entry, &inputs) {
+			return
+		}
+		script.Inputs = inputs
+		for i, input := range inputs {
+			if input.Name == "" {
+				p.report(entry.line, entry.key, severityError, "input %d has no name", i+1)
+			}
+			if _, ok := inputTypes[input.Type]; input.Type != "" && !ok {
+				p.report(entry.line, entry.key, severityWarning, "input %q has unknown type %q", input.Name, input.Type)
+			}
+		}
+	default:
+		p.report(entry.line, entry.key, severityWarning, "unknown metadata key")
+	}
+}
+
+// jsonDepth returns the bracket nesting depth after reading s, starting from
+// depth, ignoring brackets inside JSON strings.
+func jsonDepth(s string, depth int) int {
+	inString, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && r == '\\':
+			escaped = true
+		case r == '"':
+			inString = !inString
+		case inString:
+		case r == '[' || r == '{':
+			depth++
+		case r == ']' || r == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// yamlLineRe extracts the block-relative line number from a yaml.v3 error.
+var yamlLineRe = regexp.MustCompile(`line (\d+):`)
+
+// yamlBlock is a YAML metadata block found in the script header.
+type yamlBlock struct {
+	body  string
+	start int // file line number of the first body line
+	end   int // file line number of the closing marker
+}
+
+// blockOpeners maps the start of a block comment or docstring to its closer.
+var blockOpeners = map[string]string{"/*": "*/", `"""`: `"""`, "'''": "'''"}
+
+// findYAMLBlock looks for a YAML metadata block in the file header: either
+// line comments between "<comment> ---" markers, or a /* */ or JSDoc /** */
+// comment or Python docstring whose content starts with "---". Only blank lines, comments, a
+// shebang or a package clause may precede it, so a "# ---" separator further
+// down a script is not mistaken for metadata. ok is false when the block is
+// never closed.
+func findYAMLBlock(lines []string, comment string) (block *yamlBlock, ok bool) {
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.TrimSpace(strings.TrimPrefix(trimmed, comment)) == "---" && strings.HasPrefix(trimmed, comment) {
+			var body []string
+			for j := i + 1; j < len(lines); j++ {
+				line := strings.TrimSpace(lines[j])
+				if !strings.HasPrefix(line, comment) {
+					break
+				}
+				line = strings.TrimPrefix(strings.TrimLeft(lines[j], " \t"), comment)
+				if strings.TrimSpace(line) == "---" {
+					return &yamlBlock{body: strings.Join(body, "\n"), start: i + 2, end: j + 1}, true
+				}
+				body = append(body, strings.TrimPrefix(line, " "))
+			}
+			return &yamlBlock{start: i + 2, end: i + 1}, false
+		}
+		for opener, closer := range blockOpeners {
+			if !strings.HasPrefix(trimmed, opener) {
+				continue
+			}
+			// JSDoc blocks open with "/**" and start each line with " * "
+			jsdoc := opener == "/*" && strings.HasPrefix(trimmed, "/**")
+			content := func(line string) string {
+				if jsdoc {
+					if t := strings.TrimLeft(line, " \t"); strings.HasPrefix(t, "*") && !strings.HasPrefix(t, closer) {
+						return strings.TrimPrefix(t[1:], " ")
+					}
+				}
+				return line
+			}
+			rest, bodyStart := strings.TrimPrefix(trimmed, opener), i+1
+			if jsdoc {
+				rest = strings.TrimPrefix(rest, "*")
+			}
+			rest = strings.TrimSpace(rest)
+			if rest == "" && i+1 < len(lines) {
+				rest, bodyStart = strings.TrimSpace(content(lines[i+1])), i+2
+			}
+			if rest != "---" {
+				break
+			}
+			var body []string
+			for j := bodyStart; j < len(lines); j++ {
+				line := content(lines[j])
+				if strings.TrimSpace(line) == "---" || strings.HasPrefix(strings.TrimSpace(lines[j]), closer) {
+					return &yamlBlock{body: strings.Join(body, "\n"), start: bodyStart + 1, end: j + 1}, true
+				}
+				body = append(body, line)
+			}
+			return &yamlBlock{start: bodyStart + 1, end: bodyStart}, false
+		}
+		if trimmed != "" && !strings.HasPrefix(trimmed, comment) && !strings.HasPrefix(trimmed, "#!") && !strings.HasPrefix(trimmed, "package ") {
+			return nil, true
+		}
+	}
+	return nil, true
+}
+
+// applyYAML parses a YAML metadata block and applies its top-level keys.
+func (p *scriptParser) applyYAML(block *yamlBlock) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(block.body), &doc); err != nil {
+		line := block.start
+		if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			line = block.start + n - 1
+		}
+		p.report(line, "", severityError, "invalid YAML metadata: %s", strings.TrimPrefix(err.Error(), "yaml: "))
+		return
+	}
+	if len(doc.Content) == 0 {
+		return
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		p.report(block.start, "", severityError, "YAML metadata must be a mapping of keys to values")
+		return
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		p.apply(metadataEntry{key: key.Value, value: value.Value, line: block.start + key.Line - 1, node: value})
+	}
+}
+
+// parseMetadata reads the metadata of a script whose line comments start with
+// comment. A YAML block is read first and "@key:" comment lines are still
+// honoured alongside it.
+func parseMetadata(path string, content string, comment string) *scriptParser {
+	script := &Script{Path: path, ID: md5Hash(path), Fingerprint: contentFingerprint(content)}
+	p := &scriptParser{script: script, seen: make(map[string]int)}
+	commentPrefix := comment + " @"
+
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	script.Shebang = shebangOf(content)
+	block, closed := findYAMLBlock(lines, comment)
+	if block != nil {
+		if closed {
+			p.applyYAML(block)
+		} else {
+			p.report(block.start-1, "", severityError, "YAML metadata block is never closed")
+		}
+	}
+
+	var (
+		pending *metadataEntry // multi-line JSON value still being read
+		depth   int
+	)
+	for i, line := range lines {
+		lineNumber := i + 1
+		if block != nil && lineNumber >= block.start-1 && lineNumber <= block.end {
+			continue
+		}
+		if pending != nil {
+			if !strings.HasPrefix(strings.TrimSpace(line), comment) {
+				p.report(pending.line, pending.key, severityError, "multi-line value is never closed")
+				pending = nil
+				continue
+			}
+			trimmed := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), comment))
+			pending.value += "\n" + trimmed
+			if depth = jsonDepth(trimmed, depth); depth <= 0 {
+				p.apply(*pending)
+				pending = nil
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, commentPrefix) {
+			continue
+		}
+		line = strings.TrimPrefix(line, commentPrefix)
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			p.report(lineNumber, "", severityWarning, "metadata line has no \"key:\"")
+			continue
+		}
+		entry := metadataEntry{key: strings.TrimSpace(key), value: strings.TrimSpace(value), line: lineNumber}
+		// Start of a multi-line JSON value such as an inputs block
+		if strings.HasPrefix(entry.value, "[") || strings.HasPrefix(entry.value, "{") {
+			if depth = jsonDepth(entry.value, 0); depth > 0 {
+				pending = &entry
+				continue
+			}
+		}
+		p.apply(entry)
+	}
+	if pending != nil {
+		p.report(pending.line, pending.key, severityError, "multi-line value is never closed")
+	}
+	if script.Runner == runnerShebang && script.Shebang == "" {
+		p.report(p.seen["runner"], "runner", severityWarning, "runner is shebang but the file has no #! line")
+	}
+	return p
+}
+
+func parseScript(path string, content string, comment string) (*Script, error) {
+	script := parseMetadata(path, content, comment).script
+	if script.Name == "" {
+		script.Name = filepath.Base(path)
+	}
+
+	return script, nil
+}
+
+// shebangOf returns the interpreter line of a script without the leading "#!".
+func shebangOf(content string) string {
+	if !strings.HasPrefix(content, "#!") {
+		return ""
+	}
+	line, _, _ := strings.Cut(content[2:], "\n")
+	return strings.TrimSpace(line)
+}
+
+// errorCount returns the number of error diagnostics.
+func errorCount(diagnostics []Diagnostic) int {
+	count := 0
+	for _, d := range diagnostics {
+		if d.Severity == severityError {
+			count++
+		}
+	}
+	return count
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
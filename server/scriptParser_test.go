@@ -0,0 +1,219 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		start int
+		want  int
+	}{
+		{"balanced", `["a", "b"]`, 0, 0},
+		{"open list", `[`, 0, 1},
+		{"open object in list", `[{"name": "x",`, 0, 2},
+		{"closes from outer depth", `}]`, 2, 0},
+		{"brackets in strings ignored", `["a]", "{b"`, 0, 1},
+		{"escaped quote keeps string open", `["a\"]", "b"]`, 0, 0},
+		{"escaped backslash ends string", `["a\\", "]"`, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jsonDepth(tt.in, tt.start); got != tt.want {
+				t.Errorf("jsonDepth(%q, %d) = %d, want %d", tt.in, tt.start, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		comment string
+		content string
+		check   func(t *testing.T, s *Script)
+		errors  []string // substrings of expected diagnostics, in order
+	}{
+		{
+			name:    "comment lines",
+			comment: "#",
+			content: "#!/bin/bash\n# @name: Deploy\n# @description: ships it\n# @tags: [\"ops\", \"k8s\"]\n# @requires: kubectl >= 1.28, helm\necho\n",
+			check: func(t *testing.T, s *Script) {
+				want := Script{Name: "Deploy", Description: "ships it", Tags: []string{"ops", "k8s"}, Requires: []string{"kubectl >= 1.28", "helm"}, Shebang: "/bin/bash"}
+				got := Script{Name: s.Name, Description: s.Description, Tags: s.Tags, Requires: s.Requires, Shebang: s.Shebang}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %+v, want %+v", got, want)
+				}
+			},
+		},
+		{
+			name:    "multi-line JSON value",
+			comment: "//",
+			content: "// @name: x\n// @inputs: [\n//   {\"name\": \"env\", \"type\": \"select\",\n//    \"options\": [\"dev\", \"prod\"]}\n// ]\n// @author: me\n",
+			check: func(t *testing.T, s *Script) {
+				if len(s.Inputs) != 1 || s.Inputs[0].Name != "env" || len(s.Inputs[0].Options) != 2 {
+					t.Errorf("inputs = %+v", s.Inputs)
+				}
+				if s.Author != "me" {
+					t.Errorf("author = %q, want me", s.Author)
+				}
+			},
+		},
+		{
+			name:    "unclosed multi-line value",
+			comment: "#",
+			content: "# @inputs: [\n#   {\"name\": \"a\"}\necho\n",
+			errors:  []string{"multi-line value is never closed"},
+		},
+		{
+			name:    "invalid JSON",
+			comment: "#",
+			content: "# @tags: [ops\n# ]]\n",
+			errors:  []string{"invalid JSON"},
+		},
+		{
+			name:    "YAML line comments",
+			comment: "#",
+			content: "#!/usr/bin/env python3\n# ---\n# name: Report\n# tags:\n#   - daily\n#   - mail\n# requirements: [rich]\n# ---\nprint()\n",
+			check: func(t *testing.T, s *Script) {
+				if s.Name != "Report" || !reflect.DeepEqual(s.Tags, []string{"daily", "mail"}) || !reflect.DeepEqual(s.Requirements, []string{"rich"}) {
+					t.Errorf("got name %q tags %v requirements %v", s.Name, s.Tags, s.Requirements)
+				}
+			},
+		},
+		{
+			name:    "YAML block comment",
+			comment: "//",
+			content: "package main\n\n/*\n---\nname: Build\ntty: true\n---\n*/\nfunc main() {}\n",
+			check: func(t *testing.T, s *Script) {
+				if s.Name != "Build" || !s.TTY {
+					t.Errorf("got name %q tty %v", s.Name, s.TTY)
+				}
+			},
+		},
+		{
+			name:    "YAML JSDoc block",
+			comment: "//",
+			content: "/**\n * ---\n * name: Lint\n * tags:\n *   - js\n *   - ci\n * ---\n */\nconsole.log(1)\n",
+			check: func(t *testing.T, s *Script) {
+				if s.Name != "Lint" || !reflect.DeepEqual(s.Tags, []string{"js", "ci"}) {
+					t.Errorf("got name %q tags %q", s.Name, s.Tags)
+				}
+			},
+		},
+		{
+			name:    "YAML JSDoc block closed by the comment",
+			comment: "//",
+			content: "/** ---\n * name: Short\n */\nconsole.log(1)\n",
+			check: func(t *testing.T, s *Script) {
+				if s.Name != "Short" {
+					t.Errorf("got name %q", s.Name)
+				}
+			},
+		},
+		{
+			name:    "YAML docstring",
+			comment: "#",
+			content: "\"\"\"---\nname: Doc\ndescription: from a docstring\n\"\"\"\nimport os\n",
+			check: func(t *testing.T, s *Script) {
+				if s.Name != "Doc" || s.Description != "from a docstring" {
+					t.Errorf("got name %q description %q", s.Name, s.Description)
+				}
+			},
+		},
+		{
+			name:    "YAML block with comment lines",
+			comment: "#",
+			content: "# ---\n# name: Both\n# ---\n# @author: me\n",
+			check: func(t *testing.T, s *Script) {
+				if s.Name != "Both" || s.Author != "me" {
+					t.Errorf("got name %q author %q", s.Name, s.Author)
+				}
+			},
+		},
+		{
+			name:    "separator after code is not metadata",
+			comment: "#",
+			content: "echo hi\n# ---\n# name: Nope\n# ---\n",
+			check: func(t *testing.T, s *Script) {
+				if s.Name != "" {
+					t.Errorf("name = %q, want none", s.Name)
+				}
+			},
+		},
+		{
+			name:    "unclosed YAML block",
+			comment: "#",
+			content: "# ---\n# name: x\necho\n",
+			errors:  []string{"YAML metadata block is never closed"},
+		},
+		{
+			name:    "invalid YAML",
+			comment: "#",
+			content: "# ---\n# name: [x\n# ---\n",
+			errors:  []string{"invalid YAML metadata"},
+		},
+		{
+			name:    "YAML list for a single value",
+			comment: "#",
+			content: "# ---\n# name: [a, b]\n# ---\n",
+			errors:  []string{"expected a single value"},
+		},
+		{
+			name:    "invalid values",
+			comment: "#",
+			content: "# @tty: maybe\n# @id: a/b\n# @requires: kubectl >=\n",
+			errors:  []string{"expected true or false", "invalid id", "invalid requirement"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := parseMetadata("/scripts/x", tt.content, tt.comment).script
+			if tt.check != nil {
+				tt.check(t, s)
+			}
+			var errs []string
+			for _, d := range s.Diagnostics {
+				if d.Severity == severityError {
+					errs = append(errs, d.Message)
+				}
+			}
+			if len(errs) != len(tt.errors) {
+				t.Fatalf("errors = %q, want %q", errs, tt.errors)
+			}
+			for i, want := range tt.errors {
+				if !strings.Contains(errs[i], want) {
+					t.Errorf("error %d = %q, want it to contain %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMetadataWarnings(t *testing.T) {
+	content := "# @name: a\n# @name: b\n# @danger: critcal\n# @colour: red\n# no key here\n# @oops\n"
+	s := parseMetadata("/scripts/x", content, "#").script
+	var got []Diagnostic
+	for _, d := range s.Diagnostics {
+		got = append(got, Diagnostic{Line: d.Line, Key: d.Key, Severity: d.Severity})
+	}
+	want := []Diagnostic{
+		{Line: 2, Key: "name", Severity: severityWarning},
+		{Line: 3, Key: "danger", Severity: severityWarning},
+		{Line: 4, Key: "colour", Severity: severityWarning},
+		{Line: 6, Severity: severityWarning},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics = %+v, want %+v", got, want)
+	}
+	if s.Name != "b" {
+		t.Errorf("name = %q, want the last value", s.Name)
+	}
+	if token := requiredConfirmation(s); token != s.Name {
+		t.Errorf("unknown danger level requires confirmation %q, want %q", token, s.Name)
+	}
+}
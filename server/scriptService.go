@@ -1,16 +1,14 @@
 package server
 
 import (
-	"bufio"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
-	"io/fs"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -21,15 +19,16 @@ import (
 
 // --- Script Types ---
 type Input struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	Type        string      `json:"type"`
-	Required    bool        `json:"required"`
-	Default     interface{} `json:"default"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Type        string        `json:"type"`
+	Required    bool          `json:"required"`
+	Default     interface{}   `json:"default"`
+	Options     []interface{} `json:"options,omitempty"` // choices for select inputs
 }
 
 type Script struct {
-	ID          string   `json:"id"`
+	ID          string   `json:"id"` // @id when declared, otherwise derived from the path
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Author      string   `json:"author"`
@@ -37,15 +36,50 @@ type Script struct {
 	Tags        []string `json:"tags"`
 	Inputs      []Input  `json:"inputs"`
 	Path        string   `json:"path"`
+	Profiles    []string `json:"profiles"`          // allowed environment profiles, empty means any
+	Confirm     string   `json:"confirm"`           // confirmation phrase, or "true" to require the script name
+	Danger      string   `json:"danger"`            // low, medium, high or critical
+	Fingerprint string   `json:"fingerprint"`       // content hash, used to re-link moved scripts and skip unchanged files
+	Shebang     string   `json:"shebang,omitempty"` // interpreter from the #! line
+	Runner      string   `json:"runner,omitempty"`  // "shebang" executes the file directly; npm, make or just for tasks
+	Task        string   `json:"task,omitempty"`    // target in the project file at Path, run through Runner
+	// Requirements (pip) and Dependencies (npm) are installed into an isolated
+	// environment shared by scripts with the same list, see prepareScriptEnv.
+	Requirements []string `json:"requirements,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+	// Requires lists tools that must be on PATH, with optional version
+	// constraints; Readiness is the result of the last check.
+	Requires  []string   `json:"requires,omitempty"`
+	Readiness *Readiness `json:"readiness,omitempty"`
+	TTY       bool       `json:"tty,omitempty"` // run under a pseudo-terminal, see startTTY
+	// OutputSchema is the JSON Schema the result written to DEVLOOP_RESULT
+	// is checked against, see validateJSON.
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+	Favorite     bool            `json:"favorite"`
+	Pinned       bool            `json:"pinned"`                // pinned scripts are listed first
+	Snippet      string          `json:"snippet,omitempty"`     // highlighted search match, set by ListScripts
+	Diagnostics  []Diagnostic    `json:"diagnostics,omitempty"` // problems found while parsing metadata
+
+	content string // file content, indexed for search when enabled in config
+	idLine  int    // line of @id, 0 when the id is derived from the path
+	size    int64  // file size at the last reload
+	modTime int64  // file modification time at the last reload, unix nanoseconds
 }
 
 type ExecuteRequest struct {
-	Args    []string          `json:"args"`
-	Env     map[string]string `json:"env"`
-	Command string            `json:"command"`
-	Backoff int               `json:"backoff"` // milliseconds
-	Repeat  int               `json:"repeat"`  // number of times to repeat execution
-	Retry   int               `json:"retry"`   // number of retries on failure
+	Args      []string          `json:"args"`
+	Env       map[string]string `json:"env"`
+	Command   string            `json:"command"`
+	Backoff   int               `json:"backoff"`   // milliseconds
+	Repeat    int               `json:"repeat"`    // number of times to repeat execution
+	Retry     int               `json:"retry"`     // number of retries on failure
+	Profile   string            `json:"profile"`   // environment profile, defaults to config.defaultProfile
+	Confirm   string            `json:"confirm"`   // confirmation token for scripts gated by @confirm or @danger
+	Stdin     string            `json:"stdin"`     // written to the script's standard input
+	StdinOpen bool              `json:"stdinOpen"` // run in the background with stdin kept open after Stdin
+	TTY       bool              `json:"tty"`       // run under a pseudo-terminal even without @tty
+	Cols      uint16            `json:"cols"`      // initial terminal size of a TTY run
+	Rows      uint16            `json:"rows"`
 }
 
 func loadScriptsHandler(c *gin.Context) {
@@ -57,123 +91,25 @@ func loadScriptsHandler(c *gin.Context) {
 		return
 	}
 
-	cfg, err := LoadConfig()
+	report, err := reloadScripts(req.Folders, c.Query("full") == "true")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load config"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	folderSet := make(map[string]struct{})
-	for _, f := range req.Folders {
-		folderSet[f] = struct{}{}
-	}
-	for _, f := range cfg.ScriptFolders {
-		folderSet[f] = struct{}{}
-	}
-	var allFolders []string
-	for f := range folderSet {
-		allFolders = append(allFolders, f)
-	}
-	storage.ClearScripts()
-	count := 0
-	for _, folder := range allFolders {
-		err := filepath.Walk(folder, func(path string, info fs.FileInfo, err error) error {
-			if err != nil || info.IsDir() {
-				return nil
-			}
-			ext := filepath.Ext(path)
-			if _, ok := cfg.ExtensionCommands[ext]; !ok {
-				return nil
-			}
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return nil
-			}
-			script, err := parseScript(path, string(content))
-			if err != nil {
-				log.Printf("parseScript err: %v", err)
-				return nil
-			}
-			if script.Category == "" {
-				script.Category = "uncategorized"
-			}
-
-			storage.SaveScript(script)
-			count++
-			return nil
-		})
-		if err != nil {
-			continue
-		}
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Scripts loaded successfully", "count": count})
-}
-
-func parseScript(path string, content string) (*Script, error) {
-	script := &Script{Path: path, ID: md5Hash(path)}
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	var (
-		inInputsBlock bool
-		inputsLines   []string
-		commentPrefix string
-	)
-
-	// Determine comment prefix based on file extension
-	switch filepath.Ext(path) {
-	case ".py":
-		commentPrefix = "# @"
-	case ".js", ".ts", ".go", ".zx":
-		commentPrefix = "// @"
-	case ".sh", ".bash", ".zsh":
-		commentPrefix = "# @"
-	default:
-		commentPrefix = "# @" // Default to bash-style comments
-	}
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.HasPrefix(line, commentPrefix) && !inInputsBlock {
-			continue
-		}
-		if inInputsBlock {
-			trimmed := strings.TrimSpace(strings.TrimPrefix(line, strings.TrimSuffix(commentPrefix, "@")))
-			inputsLines = append(inputsLines, trimmed)
-			if strings.Contains(trimmed, "]") {
-				inInputsBlock = false
-				inputsStr := strings.Join(inputsLines, "\n")
-				inputsStr = strings.TrimSpace(inputsStr)
-				json.Unmarshal([]byte(inputsStr), &script.Inputs)
-			}
-			continue
-		}
-		line = strings.TrimPrefix(line, commentPrefix)
-		if strings.HasPrefix(line, "name:") {
-			script.Name = strings.TrimSpace(strings.TrimPrefix(line, "name:"))
-		} else if strings.HasPrefix(line, "description:") {
-			script.Description = strings.TrimSpace(strings.TrimPrefix(line, "description:"))
-		} else if strings.HasPrefix(line, "author:") {
-			script.Author = strings.TrimSpace(strings.TrimPrefix(line, "author:"))
-		} else if strings.HasPrefix(line, "category:") {
-			script.Category = strings.TrimSpace(strings.TrimPrefix(line, "category:"))
-		} else if strings.HasPrefix(line, "tags:") {
-			tags := strings.TrimSpace(strings.TrimPrefix(line, "tags:"))
-			json.Unmarshal([]byte(tags), &script.Tags)
-		} else if strings.HasPrefix(line, "inputs:") {
-			// Start of multi-line inputs block
-			after := strings.TrimSpace(strings.TrimPrefix(line, "inputs:"))
-			if strings.HasPrefix(after, "[") && !strings.HasSuffix(after, "]") {
-				inInputsBlock = true
-				inputsLines = []string{after}
-			} else {
-				// Single-line inputs
-				json.Unmarshal([]byte(after), &script.Inputs)
-			}
-		}
-	}
-	if script.Name == "" {
-		script.Name = filepath.Base(path)
-	}
-
-	return script, nil
+	if report.changed() {
+		events.publish("scripts.changed", report)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Scripts loaded successfully",
+		"count":      report.Count,
+		"counts":     report.counts(),
+		"added":      report.Added,
+		"updated":    report.Updated,
+		"removed":    report.Removed,
+		"unchanged":  report.Unchanged,
+		"migrations": report.Migrations,
+		"errors":     report.Errors,
+	})
 }
 
 func execScriptHandler(c *gin.Context) {
@@ -188,6 +124,11 @@ func execScriptHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	format := c.Query("format")
+	if err := checkOutputFormat(format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Set default values if not provided
 	if req.Backoff == 0 {
@@ -199,57 +140,293 @@ func execScriptHandler(c *gin.Context) {
 	if req.Retry < 0 {
 		req.Retry = 0 // ensure retry is not negative
 	}
+	if (script.TTY || req.TTY || req.StdinOpen) && (req.Retry > 0 || req.Repeat > 1) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "retry and repeat are not supported for tty or stdinOpen runs"})
+		return
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load config"})
+		return
+	}
+
+	profileName, profile, err := resolveProfile(cfg, req.Profile)
+	if err != nil {
+		recordAudit(c, script, "", profileName, auditRejected, err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !profileAllowed(script, profileName) {
+		recordAudit(c, script, "", profileName, auditRejected, "profile not allowed")
+		c.JSON(http.StatusForbidden, gin.H{"error": "script is not allowed to run with profile " + strconv.Quote(profileName), "profiles": script.Profiles})
+		return
+	}
+	req.Profile = profileName
+
+	// Secret values are kept out of req so they never reach history
+	secretEnv := map[string]string{}
+	if profile != nil {
+		secretEnv, err = profile.resolveSecrets()
+		if err != nil {
+			recordAudit(c, script, "", profileName, auditRejected, err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	run, err := resolveExecution(cfg, script, &req, profileName, profile, secretEnv)
+	if err != nil {
+		recordAudit(c, script, "", profileName, auditRejected, err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("dryRun") == "true" {
+		// Report what would run without starting anything or recording history
+		c.JSON(http.StatusOK, run.dryRun(cfg, script, &req))
+		return
+	}
+
+	if token := requiredConfirmation(script); token != "" && req.Confirm != token {
+		reason := "confirmation required"
+		if req.Confirm != "" {
+			reason = "confirmation mismatch"
+		}
+		recordAudit(c, script, "", profileName, auditRejected, reason)
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": reason, "confirm": token, "danger": script.Danger})
+		return
+	}
+	// From here on every failure is saved to history under historyID, so
+	// each accepted run has an entry
+	historyID := uuid.New().String()
+	recordAudit(c, script, historyID, profileName, auditAccepted, "")
 
 	log.Printf("execScriptHandler: user request: %+v", req)
 	executedAt := time.Now()
-	args := append([]string{script.Path}, req.Args...)
 
-	// Load config and add environment variables from config if present
-	cfg, err := LoadConfig()
-	if err == nil && cfg != nil && cfg.EnvironmentVariables != nil {
-		for k, v := range cfg.EnvironmentVariables {
-			req.Env[k] = v
+	// Save execution history
+	incognito := c.Query("incognito") == "true"
+	var setupLog, resultPath, artifactDir string
+	var spool *outputSpool
+	saveHistory := func(output string, exitCode int, phase string) {
+		outputSize, outputDropped, logFile := int64(len(output)), int64(0), ""
+		if spool != nil {
+			if size, dropped := spool.stats(); size > 0 {
+				outputSize, outputDropped = size, dropped
+			}
+			if incognito {
+				spool.discard()
+			} else {
+				logFile = spool.logFile()
+			}
+		}
+		var result json.RawMessage
+		var resultError string
+		if resultPath != "" {
+			result, resultError = readResult(resultPath, script.OutputSchema)
+			os.Remove(resultPath)
+		}
+		if incognito {
+			result = nil
+			maskedArgs := make([]string, len(req.Args))
+			for i := range req.Args {
+				maskedArgs[i] = "*****"
+			}
+			maskedEnv := make(map[string]string)
+			for k := range req.Env {
+				maskedEnv[k] = "*****"
+			}
+			req.Args = maskedArgs
+			req.Env = maskedEnv
+			if req.Stdin != "" {
+				req.Stdin = "*****"
+			}
+			output = "*****"
+		}
+
+		// Save the last execution's details. Output is kept as printed, like
+		// the spooled log file, and rendered when history is read
+		storage.SaveExecutionHistory(&ExecutionHistory{
+			ID:             historyID,
+			ScriptID:       id,
+			ExecutedAt:     executedAt,
+			FinishedAt:     time.Now(),
+			ExecuteRequest: req,
+			Output:         output,
+			ExitCode:       exitCode,
+			Incognito:      incognito,
+			Command:        req.Command,
+			Phase:          phase,
+			Setup:          setupLog,
+			Result:         result,
+			ResultError:    resultError,
+			LogFile:        logFile,
+			OutputSize:     outputSize,
+			OutputDropped:  outputDropped,
+		})
+
+		// Keep the files the script left in DEVLOOP_ARTIFACTS with the entry
+		if artifactDir != "" {
+			if incognito {
+				os.RemoveAll(artifactDir)
+				return
+			}
+			artifacts, err := collectArtifacts(historyID)
+			if err != nil {
+				log.Printf("execScriptHandler: collecting artifacts of %s: %v", historyID, err)
+			}
+			if len(artifacts) > 0 {
+				storage.SaveArtifacts(artifacts)
+			}
 		}
 	}
 
-	if req.Command == "" {
-		req.Command = cfg.ExtensionCommands[filepath.Ext(script.Path)]
+	if run.lang.Compile != "" {
+		binary, compileOutput, exitCode, err := buildScript(run.lang, script, run.environ())
+		if errors.Is(err, errCompile) {
+			saveHistory(compileOutput, exitCode, phaseCompile)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "phase": phaseCompile, "output": compileOutput, "historyId": historyID})
+			return
+		}
+		if err != nil {
+			saveHistory(err.Error(), -1, phaseCompile)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "phase": phaseCompile, "historyId": historyID})
+			return
+		}
+		run.argv[run.scriptArg] = binary
+	}
+
+	// Install declared dependencies into the script's isolated environment;
+	// the variables it adds are kept out of req like secrets
+	if len(script.Requirements) > 0 || len(script.Dependencies) > 0 {
+		scriptEnv, setup, err := prepareScriptEnv(cfg, script)
+		setupLog = setup
+		if err != nil {
+			saveHistory(err.Error(), -1, phaseSetup)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "phase": phaseSetup, "output": setupLog, "historyId": historyID})
+			return
+		}
+		run.runtimeEnv["PATH"] = run.getenv("PATH")
+		scriptEnv.apply(run.argv, run.runtimeEnv)
+	}
+
+	// Tools are looked up on the PATH the script will run with, including
+	// PATH from the request, config and profile and the folders of its
+	// dependency environment
+	if len(script.Requires) > 0 {
+		readiness := checkRequirements(script.Requires, run.getenv("PATH"))
+		storage.SetReadiness(script.ID, readiness)
+		if !readiness.Ready {
+			reason := "missing prerequisites: " + readiness.summary()
+			saveHistory(reason, -1, phaseRequires)
+			c.JSON(http.StatusFailedDependency, gin.H{"error": reason, "missing": readiness.Missing, "phase": phaseRequires, "historyId": historyID})
+			return
+		}
 	}
 
-	log.Printf("execScriptHandler: running command: %s %s", req.Command, strings.Join(args, " "))
+	log.Printf("execScriptHandler: running command: %s", strings.Join(run.argv, " "))
 
-	// Split the command into parts if it contains spaces
-	commandParts := strings.Fields(req.Command)
+	// Scripts may write a JSON result to the file named by DEVLOOP_RESULT
+	if resultPath, err = newResultFile(); err != nil {
+		reason := "failed to create result file: " + err.Error()
+		saveHistory(reason, -1, "")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": reason, "historyId": historyID})
+		return
+	}
+	run.setEnv(resultEnv, resultPath)
+	if err := os.MkdirAll(artifactsDir(historyID), 0755); err != nil {
+		reason := "failed to create artifacts folder: " + err.Error()
+		saveHistory(reason, -1, "")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": reason, "historyId": historyID})
+		return
+	}
+	artifactDir = artifactsDir(historyID)
+	run.setEnv(artifactsEnv, artifactDir)
 
-	// Function to execute a single run with retries
-	executeWithRetry := func() (string, int, error) {
+	// Output goes to a spool that moves large output to a log file, so memory
+	// stays bounded however much the script prints
+	logPath := outputLogPath(historyID)
+	if incognito {
+		logPath = "" // keep only the in-memory preview
+	}
+	spool = newOutputSpool(cfg.Output, logPath)
+
+	if script.TTY || req.TTY || req.StdinOpen {
+		// Terminal and open-stdin runs are interactive: they run once in the
+		// background and clients attach to them over a WebSocket
+		req.TTY = req.TTY || script.TTY
+		onExit := func(exitCode int) {
+			spool.close()
+			saveHistory(spool.String(), exitCode, "")
+		}
+		j := newJob(historyID, script.ID, spool)
+		if req.TTY {
+			err = startTTY(j, run, req.Cols, req.Rows, req.Stdin, onExit)
+		} else {
+			err = startPiped(j, run, req.Stdin, onExit)
+		}
+		if err != nil {
+			saveHistory(err.Error(), -1, "")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start script: " + err.Error(), "historyId": historyID})
+			return
+		}
+		response := gin.H{"historyId": historyID, "attach": "/api/runs/" + historyID + "/attach", "stdin": "/api/runs/" + historyID + "/stdin"}
+		if req.TTY {
+			response["tty"] = "/api/runs/" + historyID + "/tty"
+		}
+		c.JSON(http.StatusAccepted, response)
+		return
+	}
+
+	// Function to execute a single run with retries; like the result, only
+	// the output of the last attempt is kept
+	executeWithRetry := func() (int, error) {
 		var lastErr error
-		var output string
 		var exitCode int
 
 		for attempt := 0; attempt <= req.Retry; attempt++ {
-			cmd := exec.Command(commandParts[0], append(commandParts[1:], args...)...)
-			cmd.Env = os.Environ()
+			os.Truncate(resultPath, 0)
+			cmd := exec.Command(run.argv[0], run.argv[1:]...)
+			cmd.Dir = run.dir
+			cmd.Env = run.environ()
 
-			for k, v := range req.Env {
-				cmd.Env = append(cmd.Env, k+"="+v)
+			if req.Stdin != "" {
+				cmd.Stdin = strings.NewReader(req.Stdin)
 			}
-
-			var stdoutBuf, stderrBuf strings.Builder
-			cmd.Stdout = &stdoutBuf
-			cmd.Stderr = &stderrBuf
+			// Attempts that may be retried write to their own spool, which
+			// is appended to the run's output only if it is the last one
+			out := spool
+			if req.Retry > 0 {
+				attemptPath := outputLogPath(historyID + "-attempt")
+				if incognito {
+					attemptPath = ""
+				}
+				out = newOutputSpool(cfg.Output, attemptPath)
+			}
+			cmd.Stdout = out
+			cmd.Stderr = out
 
 			if err := cmd.Start(); err != nil {
+				if out != spool {
+					out.discard()
+				}
 				lastErr = err
 				if attempt < req.Retry {
 					time.Sleep(time.Duration(req.Backoff) * time.Millisecond)
 					continue
 				}
-				return "", -1, err
+				return -1, err
 			}
 
 			waitErr := cmd.Wait()
-			output = stdoutBuf.String() + stderrBuf.String()
+			if out != spool {
+				if waitErr == nil || attempt == req.Retry {
+					if err := spool.appendSpool(out); err != nil {
+						log.Printf("execScriptHandler: keeping output of %s: %v", historyID, err)
+					}
+				}
+				out.discard()
+			}
 
 			if waitErr != nil {
 				if exitErr, ok := waitErr.(*exec.ExitError); ok {
@@ -262,28 +439,27 @@ func execScriptHandler(c *gin.Context) {
 					time.Sleep(time.Duration(req.Backoff) * time.Millisecond)
 					continue
 				}
-				return output, exitCode, waitErr
+				return exitCode, waitErr
 			}
 
 			if cmd.ProcessState != nil {
 				exitCode = cmd.ProcessState.ExitCode()
 			}
-			return output, exitCode, nil
+			return exitCode, nil
 		}
-		return output, exitCode, lastErr
+		return exitCode, lastErr
 	}
 
 	// Execute the script multiple times if requested
-	var allOutputs []string
 	var allExitCodes []int
 
 	for i := 0; i < req.Repeat; i++ {
 		if i > 0 {
 			time.Sleep(time.Duration(req.Backoff) * time.Millisecond)
+			spool.Write([]byte("\n"))
 		}
 
-		output, exitCode, err := executeWithRetry()
-		allOutputs = append(allOutputs, output)
+		exitCode, err := executeWithRetry()
 		allExitCodes = append(allExitCodes, exitCode)
 
 		if err != nil && i < req.Repeat-1 {
@@ -291,41 +467,24 @@ func execScriptHandler(c *gin.Context) {
 		}
 	}
 
-	// Combine all outputs
-	combinedOutput := strings.Join(allOutputs, "\n")
-
-	// Stream the output to the client
-	c.String(http.StatusOK, combinedOutput)
+	// Combine all outputs; large output is previewed by its head and tail
+	spool.close()
+	combinedOutput := spool.String()
 
-	// Save execution history
-	incognito := c.Query("incognito") == "true"
+	// Stream the output to the client; the result is saved with the history
+	// entry. It is rendered like history output, keeping colors by default
+	c.Header("X-History-Id", historyID)
+	if format == "" {
+		format = formatANSI
+	}
+	switch format {
+	case formatHTML:
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(renderOutput(combinedOutput, format)))
+	default:
+		c.String(http.StatusOK, renderOutput(combinedOutput, format))
+	}
 
-	if incognito {
-		maskedArgs := make([]string, len(req.Args))
-		for i := range req.Args {
-			maskedArgs[i] = "*****"
-		}
-		maskedEnv := make(map[string]string)
-		for k := range req.Env {
-			maskedEnv[k] = "*****"
-		}
-		req.Args = maskedArgs
-		req.Env = maskedEnv
-		combinedOutput = "*****"
-	}
-
-	// Save the last execution's details
-	storage.SaveExecutionHistory(&ExecutionHistory{
-		ID:             uuid.New().String(),
-		ScriptID:       id,
-		ExecutedAt:     executedAt,
-		FinishedAt:     time.Now(),
-		ExecuteRequest: req,
-		Output:         combinedOutput,
-		ExitCode:       allExitCodes[len(allExitCodes)-1],
-		Incognito:      incognito,
-		Command:        req.Command,
-	})
+	saveHistory(combinedOutput, allExitCodes[len(allExitCodes)-1], "")
 }
 
 func listScriptsHandler(c *gin.Context) {
@@ -336,40 +495,32 @@ func listScriptsHandler(c *gin.Context) {
 	}
 	offset := (page - 1) * limit
 
-	search := strings.TrimSpace(strings.ToLower(c.DefaultQuery("search", "")))
-	category := strings.TrimSpace(strings.ToLower(c.DefaultQuery("category", "")))
-	tag := strings.TrimSpace(strings.ToLower(c.DefaultQuery("tag", "")))
+	// Tags may be repeated (?tag=a&tag=b) or comma separated (?tags=a,b)
+	var tags []string
+	for _, v := range append(c.QueryArray("tag"), c.QueryArray("tags")...) {
+		tags = append(tags, strings.Split(v, ",")...)
+	}
+	tagMode := strings.ToLower(c.Query("tagMode"))
+	query := ScriptQuery{
+		Search:        strings.TrimSpace(strings.ToLower(c.DefaultQuery("search", ""))),
+		Category:      strings.TrimSpace(strings.ToLower(c.DefaultQuery("category", ""))),
+		Tags:          tags,
+		MatchAllTags:  tagMode == "all" || tagMode == "and",
+		FavoritesOnly: c.Query("favorites") == "true",
+		Offset:        offset,
+		Limit:         limit,
+	}
 
-	scripts, err := storage.ListScripts(offset, limit, search, category, tag)
+	scripts, err := storage.ListScripts(query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
 
-	type ScriptMeta struct {
-		ID          string   `json:"id"`
-		Name        string   `json:"name"`
-		Description string   `json:"description"`
-		Author      string   `json:"author"`
-		Category    string   `json:"category"`
-		Tags        []string `json:"tags"`
-		Inputs      []Input  `json:"inputs"`
-		Path        string   `json:"path"`
-	}
-	var metas []ScriptMeta
-	for _, s := range scripts {
-		metas = append(metas, ScriptMeta{
-			ID:          s.ID,
-			Name:        s.Name,
-			Description: s.Description,
-			Author:      s.Author,
-			Category:    s.Category,
-			Tags:        s.Tags,
-			Inputs:      s.Inputs,
-			Path:        s.Path,
-		})
+	if scripts == nil {
+		scripts = []*Script{}
 	}
-	c.JSON(http.StatusOK, metas)
+	c.JSON(http.StatusOK, scripts)
 }
 
 func getScriptHandler(c *gin.Context) {
@@ -385,26 +536,12 @@ func getScriptHandler(c *gin.Context) {
 		return
 	}
 	type ScriptWithContent struct {
-		ID          string   `json:"id"`
-		Name        string   `json:"name"`
-		Description string   `json:"description"`
-		Author      string   `json:"author"`
-		Category    string   `json:"category"`
-		Tags        []string `json:"tags"`
-		Inputs      []Input  `json:"inputs"`
-		Path        string   `json:"path"`
-		Content     string   `json:"content"`
+		*Script
+		Content string `json:"content"`
 	}
 	resp := ScriptWithContent{
-		ID:          script.ID,
-		Name:        script.Name,
-		Description: script.Description,
-		Author:      script.Author,
-		Category:    script.Category,
-		Tags:        script.Tags,
-		Inputs:      script.Inputs,
-		Path:        script.Path,
-		Content:     string(content),
+		Script:  script,
+		Content: string(content),
 	}
 	c.JSON(http.StatusOK, resp)
 }
@@ -419,6 +556,10 @@ func deleteScriptHandler(c *gin.Context) {
 
 	// Check for "rm" query parameter
 	if c.Query("rm") == "true" {
+		if script.Task != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot remove the project file of a task"})
+			return
+		}
 		if err := os.Remove(script.Path); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove script file"})
 			return
@@ -28,6 +28,18 @@ func getConfigFolderPath() string {
 	return configFolderPath
 }
 
+// expandHome expands a leading "~" to the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
 func getDBPath() string {
 	return filepath.Join(getConfigFolderPath(), "devloop.db")
 }
@@ -57,7 +69,8 @@ func apiKeyMiddleware() gin.HandlerFunc {
 			return
 		}
 		header := c.GetHeader("Authorization")
-		if header == "Bearer "+apiKey || header == apiKey {
+		// Streams authenticate with a single-use ticket, see ticketService.go
+		if header == "Bearer "+apiKey || header == apiKey || (isStreamPath(path) && redeemStreamTicket(c.Query("ticket"))) {
 			c.Next()
 			return
 		}
@@ -75,13 +88,17 @@ func StartServer() {
 		log.Fatalf("Failed to open db: %v", err)
 	}
 
+	if cfg, err := LoadConfig(); err == nil {
+		watchScriptFolders(cfg)
+	}
+
 	r := gin.Default()
 
 	// Add CORS middleware
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Dev-Loop-User")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -94,21 +111,42 @@ func StartServer() {
 	// API endpoints
 	r.POST("/api/actions/scripts/load", loadScriptsHandler)
 	r.POST("/api/actions/exec/scripts/:id", execScriptHandler)
+	r.POST("/api/actions/scripts/lint", lintScriptsHandler)
 
 	r.GET("/api/scripts", listScriptsHandler)
+	r.GET("/api/scripts/migrations", listIdentityMigrationsHandler)
 	r.GET("/api/scripts/:id", getScriptHandler)
 	r.DELETE("/api/scripts/:id", deleteScriptHandler)
 	r.PATCH("/api/scripts/:id", openScriptHandler)
+	r.POST("/api/scripts/:id/favorite", favoriteHandler)
+	r.PUT("/api/scripts/:id/favorite", favoriteHandler)
+	r.DELETE("/api/scripts/:id/favorite", favoriteHandler)
+	r.POST("/api/scripts/:id/pin", pinHandler)
+	r.PUT("/api/scripts/:id/pin", pinHandler)
+	r.DELETE("/api/scripts/:id/pin", pinHandler)
+	r.GET("/api/scripts/:id/diagnostics", getScriptDiagnosticsHandler)
+	r.GET("/api/favorites", listFavoritesHandler)
 
 	r.GET("/api/history/scripts/:id", listScriptHistoryHandler)
+	r.GET("/api/history/search", searchHistoryHandler)
 	r.GET("/api/history/:id", getHistoryByIDHandler)
 	r.DELETE("/api/history/:id", deleteHistoryByIDHandler)
+	r.GET("/api/history/:id/artifacts", listArtifactsHandler)
+	r.GET("/api/artifacts/:id", downloadArtifactHandler)
 
 	r.GET("/api/config", getConfigHandler)
 	r.POST("/api/config", updateConfigHandler)
 
 	r.GET("/api/history/scripts/recent", recentHistoryScriptsHandler)
 	r.GET("/api/categories", listCategoriesHandler)
+	r.GET("/api/tags", listTagsHandler)
+	r.POST("/api/stream-tickets", createStreamTicketHandler)
+	r.GET("/api/events", eventsHandler)
+	r.GET("/api/runs", listRunsHandler)
+	r.GET("/api/runs/:id/attach", attachHandler)
+	r.GET("/api/runs/:id/tty", attachHandler)
+	r.POST("/api/runs/:id/stdin", writeStdinHandler)
+	r.GET("/api/audit", listAuditHandler)
 
 	port := os.Getenv("DEV_LOOP_PORT")
 	if port == "" {
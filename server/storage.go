@@ -3,7 +3,12 @@ package server
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
+	"os"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -13,22 +18,210 @@ type Storage interface {
 	ClearScripts() error
 	GetScript(id string) (*Script, error)
 	DeleteScript(id string) error
-	// ListScripts returns scripts with optional filtering by search, category, and tag.
-	ListScripts(offset, limit int, search, category, tag string) ([]*Script, error)
+	// ListScripts returns scripts with optional filtering by search, category, and tags.
+	ListScripts(query ScriptQuery) ([]*Script, error)
 	SaveExecutionHistory(history *ExecutionHistory) error
 	ListExecutionHistory(scriptID string, offset, limit int) ([]*ExecutionHistory, error)
+	// SearchExecutionHistory returns a page of non-incognito history matching the search, and the total match count.
+	SearchExecutionHistory(search HistorySearch) ([]*ExecutionHistory, int, error)
 	GetHistoryByID(id string) (*ExecutionHistory, error)
+	// DeleteHistoryByID deletes a history entry with its artifacts, including their files.
 	DeleteHistoryByID(id string) error
+	SaveArtifacts(artifacts []*Artifact) error
+	ListArtifacts(historyID string) ([]*Artifact, error)
+	GetArtifact(id string) (*Artifact, error)
+	// SetFavorite and SetPinned mark a script by ID; marks outlive ClearScripts.
+	SetFavorite(scriptID string, favorite bool) error
+	SetPinned(scriptID string, pinned bool) error
+	// ListScriptIdentities returns the identity and file state of every stored script.
+	ListScriptIdentities() ([]ScriptIdentity, error)
+	// ApplyScriptChanges applies the result of a reload in a single transaction.
+	ApplyScriptChanges(changes *ScriptChanges) error
+	ListIdentityMigrations(offset, limit int) ([]*IdentityMigration, error)
+	CountScriptsWithErrors() (int, error)
+	// SetReadiness stores the result of checking a script's @requires.
+	SetReadiness(scriptID string, readiness *Readiness) error
+	SaveAuditEntry(entry *AuditEntry) error
+	ListAuditEntries(scriptID string, offset, limit int) ([]*AuditEntry, error)
 }
 
-// CategoryCount is used for category aggregation
+// ScriptQuery filters ListScripts. Zero values are ignored.
+type ScriptQuery struct {
+	Search string
+	// Category matches the category and its subcategories, e.g. "infra" matches "infra/aws".
+	Category string
+	Tags     []string
+	// MatchAllTags requires every tag (AND) instead of any of them (OR).
+	MatchAllTags bool
+	// FavoritesOnly limits results to favorite or pinned scripts.
+	FavoritesOnly bool
+	Offset        int
+	Limit         int
+}
+
+// CategoryCount is used for category aggregation. Counts of hierarchical
+// categories such as "infra/aws" are rolled up into every parent level.
 type CategoryCount struct {
 	Category string `json:"category"`
 	Count    int    `json:"count"`
+	Parent   string `json:"parent,omitempty"`
 }
 
+// TagCount is used for tag aggregation
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// sqliteTimeFormat is a timestamp layout understood by SQLite date functions.
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
 type SQLiteStorage struct {
 	db *sql.DB
+	// fts is set when the SQLite build supports FTS5 (go build -tags sqlite_fts5);
+	// otherwise script and history searches fall back to LIKE matching.
+	fts bool
+}
+
+// scriptColumns lists the scripts table columns read by scanScript, in order.
+// Queries must alias the scripts table as "s".
+const scriptColumns = "s.id, s.name, s.description, s.author, s.category, " +
+	"(SELECT json_group_array(t.tag) FROM script_tags t WHERE t.script_id = s.id), " +
+	"s.inputs, s.path, s.profiles, s.confirm, s.danger, s.fingerprint, s.diagnostics, s.shebang, s.runner, s.task, s.requirements, s.dependencies, s.requires, s.readiness, s.output_schema, COALESCE(s.tty, 0), " +
+	"COALESCE((SELECT f.favorite FROM favorites f WHERE f.script_id = s.id), 0), " +
+	"COALESCE((SELECT f.pinned FROM favorites f WHERE f.script_id = s.id), 0) AS pinned"
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanScript reads a script selected with scriptColumns, decoding its JSON fields.
+// Any extra destinations are scanned from the columns following scriptColumns.
+func scanScript(row rowScanner, extra ...interface{}) (*Script, error) {
+	var script Script
+	var tags, inputs, profiles, confirm, danger, fingerprint, diagnostics, shebang, runner, task, requirements, dependencies, requires, readiness, outputSchema sql.NullString
+	dest := []interface{}{&script.ID, &script.Name, &script.Description, &script.Author, &script.Category, &tags, &inputs, &script.Path, &profiles, &confirm, &danger, &fingerprint, &diagnostics, &shebang, &runner, &task, &requirements, &dependencies, &requires, &readiness, &outputSchema, &script.TTY, &script.Favorite, &script.Pinned}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(tags.String), &script.Tags); err != nil {
+		script.Tags = []string{}
+	}
+	if err := json.Unmarshal([]byte(inputs.String), &script.Inputs); err != nil || script.Inputs == nil {
+		script.Inputs = []Input{}
+	}
+	if profiles.Valid && profiles.String != "" {
+		json.Unmarshal([]byte(profiles.String), &script.Profiles)
+	}
+	script.Confirm = confirm.String
+	script.Danger = danger.String
+	script.Fingerprint = fingerprint.String
+	script.Shebang = shebang.String
+	script.Runner = runner.String
+	script.Task = task.String
+	if requirements.Valid && requirements.String != "" {
+		json.Unmarshal([]byte(requirements.String), &script.Requirements)
+	}
+	if dependencies.Valid && dependencies.String != "" {
+		json.Unmarshal([]byte(dependencies.String), &script.Dependencies)
+	}
+	if requires.Valid && requires.String != "" {
+		json.Unmarshal([]byte(requires.String), &script.Requires)
+	}
+	if readiness.Valid && readiness.String != "" {
+		json.Unmarshal([]byte(readiness.String), &script.Readiness)
+	}
+	if outputSchema.String != "" {
+		script.OutputSchema = json.RawMessage(outputSchema.String)
+	}
+	if diagnostics.Valid && diagnostics.String != "" {
+		json.Unmarshal([]byte(diagnostics.String), &script.Diagnostics)
+	}
+	return &script, nil
+}
+
+// historyColumns lists the history table columns read by scanHistory, in order.
+// Queries must alias the history table as "h".
+const historyColumns = "h.id, h.script_id, h.executed_at, h.finished_at, h.execute_request, h.output, h.exitcode, h.incognito, h.command, h.phase, h.setup, h.result, h.result_error, h.log_file, h.output_size, h.output_dropped"
+
+// scanHistory reads a history entry selected with historyColumns.
+func scanHistory(row rowScanner) (*ExecutionHistory, error) {
+	var h ExecutionHistory
+	var req string
+	var incognito sql.NullBool
+	var command, phase, setup, result, resultError, logFile sql.NullString
+	var outputSize, outputDropped sql.NullInt64
+	if err := row.Scan(&h.ID, &h.ScriptID, &h.ExecutedAt, &h.FinishedAt, &req, &h.Output, &h.ExitCode, &incognito, &command, &phase, &setup, &result, &resultError, &logFile, &outputSize, &outputDropped); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(req), &h.ExecuteRequest)
+	h.Incognito = incognito.Valid && incognito.Bool
+	h.Command = command.String
+	h.Phase = phase.String
+	h.Setup = setup.String
+	if result.String != "" {
+		h.Result = json.RawMessage(result.String)
+	}
+	h.ResultError = resultError.String
+	h.LogFile = logFile.String
+	h.OutputSize = outputSize.Int64
+	if !outputSize.Valid {
+		h.OutputSize = int64(len(h.Output)) // entries from before output was measured
+	}
+	h.OutputDropped = outputDropped.Int64
+	return &h, nil
+}
+
+// hasColumn reports whether a table has the given column.
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// ensureColumn adds a column to an existing table when it is missing, so
+// databases created by older versions pick up new fields.
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	exists, err := hasColumn(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// migrateTags copies tags from the legacy scripts.tags JSON column into script_tags.
+func migrateTags(db *sql.DB) error {
+	legacy, err := hasColumn(db, "scripts", "tags")
+	if err != nil || !legacy {
+		return err
+	}
+	_, err = db.Exec(`
+	INSERT OR IGNORE INTO script_tags (script_id, tag)
+	SELECT s.id, TRIM(j.value) FROM scripts s, json_each(s.tags) j
+	WHERE json_valid(s.tags) AND s.tags != '' AND TRIM(j.value) != ''`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE scripts SET tags = NULL WHERE tags IS NOT NULL`)
+	return err
 }
 
 func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
@@ -44,9 +237,37 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 		description TEXT,
 		author TEXT,
 		category TEXT,
-		tags TEXT,
 		inputs TEXT,
-		path TEXT
+		path TEXT,
+		profiles TEXT,
+		confirm TEXT,
+		danger TEXT,
+		fingerprint TEXT,
+		diagnostics TEXT,
+		shebang TEXT,
+		runner TEXT,
+		task TEXT,
+		requirements TEXT,
+		dependencies TEXT,
+		requires TEXT,
+		readiness TEXT,
+		output_schema TEXT,
+		tty INTEGER,
+		size INTEGER,
+		mtime INTEGER,
+		parser_version INTEGER
+	);
+	CREATE TABLE IF NOT EXISTS script_tags (
+		script_id TEXT NOT NULL,
+		tag TEXT NOT NULL COLLATE NOCASE,
+		PRIMARY KEY (script_id, tag)
+	);
+	CREATE INDEX IF NOT EXISTS idx_script_tags_tag ON script_tags(tag);
+	CREATE TABLE IF NOT EXISTS favorites (
+		script_id TEXT PRIMARY KEY,
+		favorite BOOLEAN DEFAULT 0,
+		pinned BOOLEAN DEFAULT 0,
+		updated_at DATETIME
 	);
 	CREATE TABLE IF NOT EXISTS history (
 		id TEXT PRIMARY KEY,
@@ -57,77 +278,291 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 		output TEXT,
 		exitcode INTEGER DEFAULT 0,
 		incognito BOOLEAN DEFAULT 0,
-		command TEXT
+		command TEXT,
+		phase TEXT,
+		setup TEXT,
+		result TEXT,
+		result_error TEXT,
+		log_file TEXT,
+		output_size INTEGER,
+		output_dropped INTEGER
+	);
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id TEXT PRIMARY KEY,
+		script_id TEXT,
+		script_name TEXT,
+		history_id TEXT,
+		action TEXT,
+		outcome TEXT,
+		reason TEXT,
+		actor TEXT,
+		client_ip TEXT,
+		profile TEXT,
+		danger TEXT,
+		created_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_script ON audit_log(script_id, created_at);
+	CREATE TABLE IF NOT EXISTS artifacts (
+		id TEXT PRIMARY KEY,
+		history_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		size INTEGER,
+		mime_type TEXT,
+		sha256 TEXT,
+		created_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_artifacts_history ON artifacts(history_id);
+	CREATE TABLE IF NOT EXISTS identity_migrations (
+		id TEXT PRIMARY KEY,
+		old_id TEXT,
+		new_id TEXT,
+		old_path TEXT,
+		new_path TEXT,
+		reason TEXT,
+		history_rows INTEGER DEFAULT 0,
+		migrated_at DATETIME
 	);
 	`)
 	if err != nil {
 		return nil, err
 	}
-	return &SQLiteStorage{db: db}, nil
+	for _, column := range []string{"profiles", "confirm", "danger", "fingerprint", "diagnostics", "shebang", "runner", "task", "requirements", "dependencies", "requires", "readiness", "output_schema"} {
+		if err := ensureColumn(db, "scripts", column, "TEXT"); err != nil {
+			return nil, err
+		}
+	}
+	for _, column := range []string{"tty", "size", "mtime", "parser_version"} {
+		if err := ensureColumn(db, "scripts", column, "INTEGER"); err != nil {
+			return nil, err
+		}
+	}
+	for _, column := range []string{"phase", "setup", "result", "result_error", "log_file"} {
+		if err := ensureColumn(db, "history", column, "TEXT"); err != nil {
+			return nil, err
+		}
+	}
+	for _, column := range []string{"output_size", "output_dropped"} {
+		if err := ensureColumn(db, "history", column, "INTEGER"); err != nil {
+			return nil, err
+		}
+	}
+	if err := ensureColumn(db, "audit_log", "client_ip", "TEXT"); err != nil {
+		return nil, err
+	}
+	if err := migrateTags(db); err != nil {
+		return nil, err
+	}
+	s := &SQLiteStorage{db: db}
+	if err := s.initSearch(); err != nil {
+		log.Printf("Full-text search unavailable, falling back to LIKE search (build with -tags sqlite_fts5): %v", err)
+	}
+	return s, nil
+}
+
+// initSearch creates the FTS5 indexes over scripts and history and fills them
+// from their source tables when they are new. history_fts holds the output
+// stored on the entry, which for spooled runs is only the head and tail; the
+// rest of a log file is not searchable.
+func (s *SQLiteStorage) initSearch() error {
+	_, err := s.db.Exec(`
+	CREATE VIRTUAL TABLE IF NOT EXISTS scripts_fts USING fts5(
+		id UNINDEXED, name, description, author, category, tags, content,
+		tokenize = 'unicode61 remove_diacritics 2'
+	);
+	CREATE VIRTUAL TABLE IF NOT EXISTS history_fts USING fts5(
+		id UNINDEXED, output, command, args,
+		tokenize = 'unicode61 remove_diacritics 2'
+	);`)
+	if err != nil {
+		return err
+	}
+	backfills := []struct{ table, fill string }{
+		{"scripts_fts", `
+		INSERT INTO scripts_fts (id, name, description, author, category, tags, content)
+		SELECT id, name, description, author, category, COALESCE((SELECT group_concat(tag, ' ') FROM script_tags WHERE script_id = scripts.id), ''), ''
+		FROM scripts`},
+		{"history_fts", `
+		INSERT INTO history_fts (id, output, command, args)
+		SELECT id, output, command, COALESCE((SELECT group_concat(value, ' ') FROM json_each(execute_request, '$.args')), '')
+		FROM history WHERE NOT incognito AND json_valid(execute_request)`},
+	}
+	for _, b := range backfills {
+		var indexed int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM ` + b.table).Scan(&indexed); err != nil {
+			return err
+		}
+		if indexed > 0 {
+			continue
+		}
+		if _, err := s.db.Exec(b.fill); err != nil {
+			return err
+		}
+	}
+	s.fts = true
+	return nil
 }
 
 func (s *SQLiteStorage) ClearScripts() error {
-	_, err := s.db.Exec(`DELETE FROM scripts;`)
+	_, err := s.db.Exec(`DELETE FROM scripts; DELETE FROM script_tags;`)
+	if err == nil && s.fts {
+		_, err = s.db.Exec(`DELETE FROM scripts_fts;`)
+	}
 	return err
 }
 
 func (s *SQLiteStorage) SaveScript(script *Script) error {
-	tags, _ := json.Marshal(script.Tags)
-	inputs, _ := json.Marshal(script.Inputs)
-	_, err := s.db.Exec(`
-	INSERT OR REPLACE INTO scripts (id, name, description, author, category, tags, inputs, path)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		script.ID, script.Name, script.Description, script.Author, script.Category, string(tags), string(inputs), script.Path)
-	return err
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := s.saveScript(tx, script); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (s *SQLiteStorage) GetScript(id string) (*Script, error) {
-	row := s.db.QueryRow(`SELECT id, name, description, author, category, tags, inputs, path FROM scripts WHERE id = ?`, id)
-	var script Script
-	var tags, inputs string
-	err := row.Scan(&script.ID, &script.Name, &script.Description, &script.Author, &script.Category, &tags, &inputs, &script.Path)
+// jsonList encodes a list for a TEXT column, storing NULL when it is empty.
+func jsonList(values []string) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	encoded, _ := json.Marshal(values)
+	return string(encoded)
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// saveScript writes a script with its tags and search index entry.
+func (s *SQLiteStorage) saveScript(tx execer, script *Script) error {
+	inputs, _ := json.Marshal(script.Inputs)
+	profiles, _ := json.Marshal(script.Profiles)
+	var diagnostics interface{}
+	if len(script.Diagnostics) > 0 {
+		encoded, _ := json.Marshal(script.Diagnostics)
+		diagnostics = string(encoded)
+	}
+	var readiness interface{}
+	if script.Readiness != nil {
+		encoded, _ := json.Marshal(script.Readiness)
+		readiness = string(encoded)
+	}
+	_, err := tx.Exec(`
+	INSERT OR REPLACE INTO scripts (id, name, description, author, category, inputs, path, profiles, confirm, danger, fingerprint, diagnostics, shebang, runner, task, requirements, dependencies, requires, readiness, output_schema, tty, size, mtime, parser_version)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		script.ID, script.Name, script.Description, script.Author, script.Category, string(inputs), script.Path, string(profiles), script.Confirm, script.Danger, script.Fingerprint, diagnostics, script.Shebang, script.Runner, script.Task, jsonList(script.Requirements), jsonList(script.Dependencies), jsonList(script.Requires), readiness, string(script.OutputSchema), script.TTY, script.size, script.modTime, scriptParserVersion)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	// Unmarshal tags
-	if err := json.Unmarshal([]byte(tags), &script.Tags); err != nil {
-		script.Tags = []string{}
+	if _, err := tx.Exec(`DELETE FROM script_tags WHERE script_id = ?`, script.ID); err != nil {
+		return err
 	}
-	// Unmarshal inputs with fallback to empty slice
-	if err := json.Unmarshal([]byte(inputs), &script.Inputs); err != nil || script.Inputs == nil {
-		script.Inputs = []Input{}
+	for _, tag := range script.Tags {
+		if tag = strings.TrimSpace(tag); tag == "" {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO script_tags (script_id, tag) VALUES (?, ?)`, script.ID, tag); err != nil {
+			return err
+		}
 	}
-	return &script, nil
+	if s.fts {
+		if _, err := tx.Exec(`DELETE FROM scripts_fts WHERE id = ?`, script.ID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO scripts_fts (id, name, description, author, category, tags, content) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			script.ID, script.Name, script.Description, script.Author, script.Category, strings.Join(script.Tags, " "), script.content)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) GetScript(id string) (*Script, error) {
+	row := s.db.QueryRow(`SELECT `+scriptColumns+` FROM scripts s WHERE s.id = ?`, id)
+	return scanScript(row)
 }
 
 func (s *SQLiteStorage) DeleteScript(id string) error {
-	_, err := s.db.Exec(`DELETE FROM scripts WHERE id = ?`, id)
+	return s.deleteScript(s.db, id)
+}
+
+func (s *SQLiteStorage) deleteScript(tx execer, id string) error {
+	_, err := tx.Exec(`DELETE FROM scripts WHERE id = ?; DELETE FROM script_tags WHERE script_id = ?`, id, id)
+	if err == nil && s.fts {
+		_, err = tx.Exec(`DELETE FROM scripts_fts WHERE id = ?`, id)
+	}
 	return err
 }
 
-func (s *SQLiteStorage) ListScripts(offset, limit int, search, category, tag string) ([]*Script, error) {
+// ftsTerms splits text into terms the way the FTS5 unicode61 tokenizer
+// splits indexed text: on anything that is not a letter or digit.
+func ftsTerms(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ftsQuery turns free text into an FTS5 query that requires every term,
+// matching each as a prefix. It returns "" when the text has no terms.
+func ftsQuery(text string) string {
+	terms := ftsTerms(text)
+	for i, term := range terms {
+		terms[i] = `"` + term + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+func (s *SQLiteStorage) ListScripts(q ScriptQuery) ([]*Script, error) {
 	var args []interface{}
 	var wheres []string
+	search := q.Search
 
+	query := "SELECT " + scriptColumns + " FROM scripts s"
+	order := " ORDER BY pinned DESC, s.name COLLATE NOCASE"
+	ranked := false
 	if search != "" {
-		wheres = append(wheres, "(name LIKE ? OR description LIKE ? OR author LIKE ? OR category LIKE ? OR tags LIKE ? OR path LIKE ?)")
-		q := "%" + search + "%"
-		args = append(args, q, q, q, q, q, q)
+		if match := ftsQuery(search); s.fts && match != "" {
+			// Rank with BM25, weighting name over tags, description, category, author and content
+			query = "SELECT " + scriptColumns + ", snippet(scripts_fts, -1, '<mark>', '</mark>', '…', 12) FROM scripts_fts JOIN scripts s ON s.id = scripts_fts.id"
+			wheres = append(wheres, "scripts_fts MATCH ?")
+			args = append(args, match)
+			order = " ORDER BY pinned DESC, bm25(scripts_fts, 0, 10.0, 4.0, 2.0, 3.0, 5.0, 1.0)"
+			ranked = true
+		} else {
+			wheres = append(wheres, `(s.name LIKE ? ESCAPE '\' OR s.description LIKE ? ESCAPE '\' OR s.author LIKE ? ESCAPE '\' OR s.category LIKE ? ESCAPE '\' OR s.path LIKE ? ESCAPE '\' OR EXISTS (SELECT 1 FROM script_tags t WHERE t.script_id = s.id AND t.tag LIKE ? ESCAPE '\'))`)
+			like := "%" + likeEscaper.Replace(search) + "%"
+			args = append(args, like, like, like, like, like, like)
+		}
 	}
-	if category != "" {
-		wheres = append(wheres, "LOWER(category) = ?")
-		args = append(args, strings.ToLower(category))
+	if q.Category != "" {
+		category := strings.ToLower(strings.Trim(q.Category, "/"))
+		wheres = append(wheres, `(LOWER(s.category) = ? OR LOWER(s.category) LIKE ? ESCAPE '\')`)
+		args = append(args, category, likeEscaper.Replace(category)+"/%")
 	}
-	if tag != "" {
-		wheres = append(wheres, "tags LIKE ?") // simple LIKE match for tag string
-		args = append(args, "%"+tag+"%")
+	if tags := normalizeTags(q.Tags); len(tags) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(tags)), ",")
+		sub := "SELECT script_id FROM script_tags WHERE tag IN (" + placeholders + ")"
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+		if q.MatchAllTags {
+			sub += " GROUP BY script_id HAVING COUNT(DISTINCT tag) = ?"
+			args = append(args, len(tags))
+		}
+		wheres = append(wheres, "s.id IN ("+sub+")")
+	}
+	if q.FavoritesOnly {
+		wheres = append(wheres, "s.id IN (SELECT script_id FROM favorites WHERE favorite OR pinned)")
 	}
-	query := "SELECT id, name, description, author, category, tags, inputs, path FROM scripts"
 	if len(wheres) > 0 {
 		query += " WHERE " + strings.Join(wheres, " AND ")
 	}
-	query += " LIMIT ? OFFSET ?"
-	args = append(args, limit, offset)
+	query += order + " LIMIT ? OFFSET ?"
+	args = append(args, q.Limit, q.Offset)
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
@@ -136,83 +571,369 @@ func (s *SQLiteStorage) ListScripts(offset, limit int, search, category, tag str
 	defer rows.Close()
 	var scripts []*Script
 	for rows.Next() {
-		var script Script
-		var tags, inputs string
-		if err := rows.Scan(&script.ID, &script.Name, &script.Description, &script.Author, &script.Category, &tags, &inputs, &script.Path); err != nil {
+		var extra []interface{}
+		var snippet sql.NullString
+		if ranked {
+			extra = append(extra, &snippet)
+		}
+		script, err := scanScript(rows, extra...)
+		if err != nil {
 			continue
 		}
-		if err := json.Unmarshal([]byte(tags), &script.Tags); err != nil {
-			script.Tags = []string{}
+		script.Snippet = snippet.String
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+func (s *SQLiteStorage) SetFavorite(scriptID string, favorite bool) error {
+	return s.setFavoriteFlag(scriptID, "favorite", favorite)
+}
+
+func (s *SQLiteStorage) SetPinned(scriptID string, pinned bool) error {
+	return s.setFavoriteFlag(scriptID, "pinned", pinned)
+}
+
+func (s *SQLiteStorage) setFavoriteFlag(scriptID, column string, value bool) error {
+	_, err := s.db.Exec(`
+	INSERT INTO favorites (script_id, `+column+`, updated_at) VALUES (?, ?, ?)
+	ON CONFLICT(script_id) DO UPDATE SET `+column+` = excluded.`+column+`, updated_at = excluded.updated_at`,
+		scriptID, value, time.Now())
+	if err != nil {
+		return err
+	}
+	// Drop rows that no longer mark anything
+	_, err = s.db.Exec(`DELETE FROM favorites WHERE script_id = ? AND NOT favorite AND NOT pinned`, scriptID)
+	return err
+}
+
+func (s *SQLiteStorage) ListScriptIdentities() ([]ScriptIdentity, error) {
+	rows, err := s.db.Query(`SELECT id, name, path, COALESCE(fingerprint, ''), COALESCE(size, -1), COALESCE(mtime, 0), COALESCE(parser_version, 0) FROM scripts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var identities []ScriptIdentity
+	for rows.Next() {
+		var identity ScriptIdentity
+		if err := rows.Scan(&identity.ID, &identity.Name, &identity.Path, &identity.Fingerprint, &identity.Size, &identity.ModTime, &identity.ParserVersion); err != nil {
+			continue
 		}
-		if inputs == "" {
-			script.Inputs = []Input{}
-		} else {
-			if err := json.Unmarshal([]byte(inputs), &script.Inputs); err != nil {
-				return nil, err
-			}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (s *SQLiteStorage) ApplyScriptChanges(changes *ScriptChanges) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i := range changes.Relink {
+		m := &changes.Relink[i]
+		res, err := tx.Exec(`UPDATE history SET script_id = ? WHERE script_id = ?`, m.NewID, m.OldID)
+		if err != nil {
+			return err
+		}
+		m.HistoryRows, _ = res.RowsAffected()
+		if _, err := tx.Exec(`UPDATE OR REPLACE favorites SET script_id = ? WHERE script_id = ?`, m.NewID, m.OldID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE audit_log SET script_id = ? WHERE script_id = ?`, m.NewID, m.OldID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+		INSERT INTO identity_migrations (id, old_id, new_id, old_path, new_path, reason, history_rows, migrated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.ID, m.OldID, m.NewID, m.OldPath, m.NewPath, m.Reason, m.HistoryRows, m.MigratedAt)
+		if err != nil {
+			return err
 		}
-		scripts = append(scripts, &script)
 	}
-	return scripts, nil
+	for _, id := range changes.Delete {
+		if err := s.deleteScript(tx, id); err != nil {
+			return err
+		}
+	}
+	for _, script := range changes.Save {
+		if err := s.saveScript(tx, script); err != nil {
+			return err
+		}
+	}
+	for _, identity := range changes.Touch {
+		if _, err := tx.Exec(`UPDATE scripts SET size = ?, mtime = ? WHERE id = ?`, identity.Size, identity.ModTime, identity.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) SetReadiness(scriptID string, readiness *Readiness) error {
+	encoded, _ := json.Marshal(readiness)
+	_, err := s.db.Exec(`UPDATE scripts SET readiness = ? WHERE id = ?`, string(encoded), scriptID)
+	return err
+}
+
+// CountScriptsWithErrors returns how many scripts have at least one error diagnostic.
+func (s *SQLiteStorage) CountScriptsWithErrors() (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+	SELECT COUNT(*) FROM scripts
+	WHERE diagnostics IS NOT NULL AND EXISTS (
+		SELECT 1 FROM json_each(scripts.diagnostics) d WHERE json_extract(d.value, '$.severity') = 'error'
+	)`).Scan(&count)
+	return count, err
+}
+
+func (s *SQLiteStorage) ListIdentityMigrations(offset, limit int) ([]*IdentityMigration, error) {
+	rows, err := s.db.Query(`SELECT id, old_id, new_id, old_path, new_path, reason, history_rows, migrated_at FROM identity_migrations ORDER BY migrated_at DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var migrations []*IdentityMigration
+	for rows.Next() {
+		var m IdentityMigration
+		if err := rows.Scan(&m.ID, &m.OldID, &m.NewID, &m.OldPath, &m.NewPath, &m.Reason, &m.HistoryRows, &m.MigratedAt); err != nil {
+			continue
+		}
+		migrations = append(migrations, &m)
+	}
+	return migrations, nil
 }
 
 func (s *SQLiteStorage) SaveExecutionHistory(history *ExecutionHistory) error {
 	req, _ := json.Marshal(history.ExecuteRequest)
 	_, err := s.db.Exec(`
-	INSERT INTO history (id, script_id, executed_at, finished_at, execute_request, output, exitcode, incognito, command)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		history.ID, history.ScriptID, history.ExecutedAt, history.FinishedAt, string(req), history.Output, history.ExitCode, history.Incognito, history.Command)
+	INSERT INTO history (id, script_id, executed_at, finished_at, execute_request, output, exitcode, incognito, command, phase, setup, result, result_error, log_file, output_size, output_dropped)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		history.ID, history.ScriptID, history.ExecutedAt, history.FinishedAt, string(req), history.Output, history.ExitCode, history.Incognito, history.Command, history.Phase, history.Setup, string(history.Result), history.ResultError, history.LogFile, history.OutputSize, history.OutputDropped)
+	if err == nil && s.fts && !history.Incognito {
+		_, err = s.db.Exec(`INSERT INTO history_fts (id, output, command, args) VALUES (?, ?, ?, ?)`,
+			history.ID, renderOutput(history.Output, formatPlain), history.Command, strings.Join(history.ExecuteRequest.Args, " "))
+	}
 	return err
 }
 
 func (s *SQLiteStorage) ListExecutionHistory(scriptID string, offset, limit int) ([]*ExecutionHistory, error) {
-	rows, err := s.db.Query(`SELECT id, script_id, executed_at, finished_at, execute_request, output, exitcode, incognito, command FROM history WHERE script_id = ? ORDER BY executed_at DESC LIMIT ? OFFSET ?`, scriptID, limit, offset)
+	rows, err := s.db.Query(`SELECT `+historyColumns+` FROM history h WHERE h.script_id = ? ORDER BY h.executed_at DESC LIMIT ? OFFSET ?`, scriptID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var histories []*ExecutionHistory
 	for rows.Next() {
-		var h ExecutionHistory
-		var req string
-		var incognito sql.NullBool
-		var command sql.NullString
-		if err := rows.Scan(&h.ID, &h.ScriptID, &h.ExecutedAt, &h.FinishedAt, &req, &h.Output, &h.ExitCode, &incognito, &command); err != nil {
+		h, err := scanHistory(rows)
+		if err != nil {
 			continue
 		}
-		json.Unmarshal([]byte(req), &h.ExecuteRequest)
-		h.Incognito = incognito.Valid && incognito.Bool
-		if command.Valid {
-			h.Command = command.String
-		}
-		histories = append(histories, &h)
+		histories = append(histories, h)
 	}
 	return histories, nil
 }
 
 func (s *SQLiteStorage) GetHistoryByID(id string) (*ExecutionHistory, error) {
-	row := s.db.QueryRow(`SELECT id, script_id, executed_at, finished_at, execute_request, output, exitcode, incognito, command FROM history WHERE id = ?`, id)
-	var h ExecutionHistory
-	var req string
-	var incognito sql.NullBool
-	var command sql.NullString
-	err := row.Scan(&h.ID, &h.ScriptID, &h.ExecutedAt, &h.FinishedAt, &req, &h.Output, &h.ExitCode, &incognito, &command)
+	return scanHistory(s.db.QueryRow(`SELECT `+historyColumns+` FROM history h WHERE h.id = ?`, id))
+}
+
+// DeleteHistoryByID deletes a history entry with its artifacts and output
+// log. Files are only removed for an entry that existed, so an id taken
+// from a URL can never name a folder outside the entry's own.
+func (s *SQLiteStorage) DeleteHistoryByID(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM history WHERE id = ?`, id)
 	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM artifacts WHERE history_id = ?`, id); err != nil {
+		return err
+	}
+	if s.fts {
+		if _, err := tx.Exec(`DELETE FROM history_fts WHERE id = ?`, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Files go only once the rows are gone, so a failed delete loses nothing
+	if !isPathElement(id) {
+		return nil
+	}
+	if err := os.RemoveAll(artifactsDir(id)); err != nil {
+		return err
+	}
+	if err := os.Remove(outputLogPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) SaveArtifacts(artifacts []*Artifact) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, a := range artifacts {
+		if _, err := tx.Exec(`INSERT INTO artifacts (id, history_id, name, size, mime_type, sha256, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			a.ID, a.HistoryID, a.Name, a.Size, a.MimeType, a.SHA256, a.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// artifactColumns lists the artifacts table columns read by scanArtifact, in order.
+const artifactColumns = "id, history_id, name, size, mime_type, sha256, created_at"
+
+func scanArtifact(row rowScanner) (*Artifact, error) {
+	var a Artifact
+	if err := row.Scan(&a.ID, &a.HistoryID, &a.Name, &a.Size, &a.MimeType, &a.SHA256, &a.CreatedAt); err != nil {
 		return nil, err
 	}
-	json.Unmarshal([]byte(req), &h.ExecuteRequest)
-	h.Incognito = incognito.Valid && incognito.Bool
-	if command.Valid {
-		h.Command = command.String
+	return &a, nil
+}
+
+func (s *SQLiteStorage) ListArtifacts(historyID string) ([]*Artifact, error) {
+	rows, err := s.db.Query(`SELECT `+artifactColumns+` FROM artifacts WHERE history_id = ? ORDER BY name`, historyID)
+	if err != nil {
+		return nil, err
 	}
-	return &h, nil
+	defer rows.Close()
+	var artifacts []*Artifact
+	for rows.Next() {
+		a, err := scanArtifact(rows)
+		if err != nil {
+			continue
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, nil
 }
 
-func (s *SQLiteStorage) DeleteHistoryByID(id string) error {
-	_, err := s.db.Exec(`DELETE FROM history WHERE id = ?`, id)
+func (s *SQLiteStorage) GetArtifact(id string) (*Artifact, error) {
+	return scanArtifact(s.db.QueryRow(`SELECT `+artifactColumns+` FROM artifacts WHERE id = ?`, id))
+}
+
+func (s *SQLiteStorage) SearchExecutionHistory(search HistorySearch) ([]*ExecutionHistory, int, error) {
+	from := " FROM history h"
+	wheres := []string{"NOT h.incognito"}
+	var args []interface{}
+	if search.Query != "" {
+		if match := ftsQuery(search.Query); s.fts && match != "" {
+			from += " JOIN history_fts ON history_fts.id = h.id"
+			wheres = append(wheres, "history_fts MATCH ?")
+			args = append(args, match)
+		} else {
+			// Only the indexed fields: execute_request also holds env and stdin
+			wheres = append(wheres, `(h.output LIKE ? ESCAPE '\' OR h.command LIKE ? ESCAPE '\'
+			OR (json_valid(h.execute_request) AND EXISTS (SELECT 1 FROM json_each(h.execute_request, '$.args') WHERE value LIKE ? ESCAPE '\')))`)
+			q := "%" + likeEscaper.Replace(search.Query) + "%"
+			args = append(args, q, q, q)
+		}
+	}
+	if search.ScriptID != "" {
+		wheres = append(wheres, "h.script_id = ?")
+		args = append(args, search.ScriptID)
+	}
+	if search.Phase != "" {
+		wheres = append(wheres, "h.phase = ?")
+		args = append(args, search.Phase)
+	}
+	if search.ExitCode != nil {
+		wheres = append(wheres, "h.exitcode = ?")
+		args = append(args, *search.ExitCode)
+	}
+	if !search.From.IsZero() {
+		wheres = append(wheres, "julianday(h.executed_at) >= julianday(?)")
+		args = append(args, search.From.UTC().Format(sqliteTimeFormat))
+	}
+	if !search.To.IsZero() {
+		wheres = append(wheres, "julianday(h.executed_at) <= julianday(?)")
+		args = append(args, search.To.UTC().Format(sqliteTimeFormat))
+	}
+	const durationMs = "(julianday(h.finished_at) - julianday(h.executed_at)) * 86400000.0"
+	if search.MinDuration > 0 {
+		wheres = append(wheres, durationMs+" >= ?")
+		args = append(args, search.MinDuration.Milliseconds())
+	}
+	if search.MaxDuration > 0 {
+		wheres = append(wheres, durationMs+" <= ?")
+		args = append(args, search.MaxDuration.Milliseconds())
+	}
+	where := " WHERE " + strings.Join(wheres, " AND ")
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	query := "SELECT " + historyColumns + from + where + " ORDER BY h.executed_at DESC LIMIT ? OFFSET ?"
+	rows, err := s.db.Query(query, append(args, search.Limit, search.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var histories []*ExecutionHistory
+	for rows.Next() {
+		h, err := scanHistory(rows)
+		if err != nil {
+			continue
+		}
+		histories = append(histories, h)
+	}
+	return histories, total, nil
+}
+
+func (s *SQLiteStorage) SaveAuditEntry(entry *AuditEntry) error {
+	_, err := s.db.Exec(`
+	INSERT INTO audit_log (id, script_id, script_name, history_id, action, outcome, reason, actor, client_ip, profile, danger, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.ScriptID, entry.ScriptName, entry.HistoryID, entry.Action, entry.Outcome, entry.Reason, entry.Actor, entry.ClientIP, entry.Profile, entry.Danger, entry.CreatedAt)
 	return err
 }
 
+// ListAuditEntries returns audit entries newest first, optionally for a single script.
+func (s *SQLiteStorage) ListAuditEntries(scriptID string, offset, limit int) ([]*AuditEntry, error) {
+	query := `SELECT id, script_id, script_name, history_id, action, outcome, reason, actor, client_ip, profile, danger, created_at FROM audit_log`
+	var args []interface{}
+	if scriptID != "" {
+		query += ` WHERE script_id = ?`
+		args = append(args, scriptID)
+	}
+	query += ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []*AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var historyID, reason, clientIP, profile, danger sql.NullString
+		if err := rows.Scan(&e.ID, &e.ScriptID, &e.ScriptName, &historyID, &e.Action, &e.Outcome, &reason, &e.Actor, &clientIP, &profile, &danger, &e.CreatedAt); err != nil {
+			continue
+		}
+		e.HistoryID = historyID.String
+		e.Reason = reason.String
+		e.ClientIP = clientIP.String
+		e.Profile = profile.String
+		e.Danger = danger.String
+		entries = append(entries, &e)
+	}
+	return entries, nil
+}
+
 // Returns up to `limit` unique script IDs from the last `historyLimit` history entries
 func (s *SQLiteStorage) GetRecentScriptIDs(historyLimit, limit int) ([]string, error) {
 	rows, err := s.db.Query(`SELECT script_id FROM history ORDER BY executed_at DESC LIMIT ?`, historyLimit)
@@ -249,7 +970,7 @@ func (s *SQLiteStorage) GetScriptsByIDs(ids []string) ([]Script, error) {
 		placeholders[i] = "?"
 		args[i] = id
 	}
-	query := `SELECT id, name, description, author, category, tags, inputs, path FROM scripts WHERE id IN (` + strings.Join(placeholders, ",") + `)`
+	query := `SELECT ` + scriptColumns + ` FROM scripts s WHERE s.id IN (` + strings.Join(placeholders, ",") + `)`
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
@@ -257,18 +978,11 @@ func (s *SQLiteStorage) GetScriptsByIDs(ids []string) ([]Script, error) {
 	defer rows.Close()
 	var scripts []Script
 	for rows.Next() {
-		var s Script
-		var tags, inputs string
-		if err := rows.Scan(&s.ID, &s.Name, &s.Description, &s.Author, &s.Category, &tags, &inputs, &s.Path); err != nil {
+		script, err := scanScript(rows)
+		if err != nil {
 			continue
 		}
-		json.Unmarshal([]byte(tags), &s.Tags)
-		if inputs == "" {
-			s.Inputs = []Input{}
-		} else {
-			json.Unmarshal([]byte(inputs), &s.Inputs)
-		}
-		scripts = append(scripts, s)
+		scripts = append(scripts, *script)
 	}
 	return scripts, nil
 }
@@ -276,7 +990,7 @@ func (s *SQLiteStorage) GetScriptsByIDs(ids []string) ([]Script, error) {
 // Returns up to `limit` recent scripts (metadata, no content) that have history, using SQL join/group by
 func (s *SQLiteStorage) GetRecentScriptsWithHistory(limit int) ([]Script, error) {
 	query := `
-	SELECT s.id, s.name, s.description, s.author, s.category, s.tags, s.inputs, s.path
+	SELECT ` + scriptColumns + `
 	FROM scripts s
 	JOIN (
 	    SELECT script_id, MAX(executed_at) as last_executed
@@ -295,36 +1009,89 @@ func (s *SQLiteStorage) GetRecentScriptsWithHistory(limit int) ([]Script, error)
 	defer rows.Close()
 	var scripts []Script
 	for rows.Next() {
-		var s Script
-		var tags, inputs string
-		if err := rows.Scan(&s.ID, &s.Name, &s.Description, &s.Author, &s.Category, &tags, &inputs, &s.Path); err != nil {
+		script, err := scanScript(rows)
+		if err != nil {
 			continue
 		}
-		json.Unmarshal([]byte(tags), &s.Tags)
-		if inputs == "" {
-			s.Inputs = []Input{}
-		} else {
-			json.Unmarshal([]byte(inputs), &s.Inputs)
-		}
-		scripts = append(scripts, s)
+		scripts = append(scripts, *script)
 	}
 	return scripts, nil
 }
 
-// ListCategoryCounts returns a list of categories and the count of scripts in each
+// ListCategoryCounts returns a list of categories and the count of scripts in each,
+// including every parent level of hierarchical categories.
 func (s *SQLiteStorage) ListCategoryCounts() ([]CategoryCount, error) {
-	rows, err := s.db.Query(`SELECT COALESCE(NULLIF(TRIM(LOWER(category)), ''), 'uncategorized') as category, COUNT(*) as count FROM scripts GROUP BY category`)
+	rows, err := s.db.Query(`SELECT COALESCE(NULLIF(TRIM(LOWER(category)), ''), 'uncategorized') as category, COUNT(*) as count FROM scripts GROUP BY 1`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var result []CategoryCount
+	counts := make(map[string]*CategoryCount)
 	for rows.Next() {
-		var cat CategoryCount
-		if err := rows.Scan(&cat.Category, &cat.Count); err != nil {
+		var category string
+		var count int
+		if err := rows.Scan(&category, &count); err != nil {
 			continue
 		}
-		result = append(result, cat)
+		var levels []string
+		for _, part := range strings.Split(category, "/") {
+			if part = strings.TrimSpace(part); part != "" {
+				levels = append(levels, part)
+			}
+		}
+		for i := range levels {
+			name := strings.Join(levels[:i+1], "/")
+			cat, ok := counts[name]
+			if !ok {
+				cat = &CategoryCount{Category: name, Parent: strings.Join(levels[:i], "/")}
+				counts[name] = cat
+			}
+			cat.Count += count
+		}
+	}
+	result := make([]CategoryCount, 0, len(counts))
+	for _, cat := range counts {
+		result = append(result, *cat)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Category < result[j].Category })
+	return result, nil
+}
+
+// ListTagCounts returns every tag and the count of scripts carrying it
+func (s *SQLiteStorage) ListTagCounts() ([]TagCount, error) {
+	rows, err := s.db.Query(`
+	SELECT LOWER(t.tag), COUNT(DISTINCT t.script_id) FROM script_tags t
+	JOIN scripts s ON s.id = t.script_id
+	GROUP BY LOWER(t.tag) ORDER BY 2 DESC, 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []TagCount
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			continue
+		}
+		result = append(result, tag)
 	}
 	return result, nil
 }
+
+// likeEscaper escapes LIKE wildcards for patterns using ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// normalizeTags trims, lowercases and de-duplicates tag filters.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]struct{}, len(tags))
+	var result []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if _, ok := seen[tag]; ok || tag == "" {
+			continue
+		}
+		seen[tag] = struct{}{}
+		result = append(result, tag)
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+//go:build sqlite_fts5
+
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestListScriptsFTS(t *testing.T) {
+	s := newTestStorage(t)
+	if !s.fts {
+		t.Fatal("FTS5 is not available although the binary is built with -tags sqlite_fts5")
+	}
+	saveTestScripts(t, s,
+		&Script{ID: "notes", Name: "Notes", Description: "mentions deploy once", Path: "/s/notes.sh"},
+		&Script{ID: "deploy", Name: "Deploy", Description: "deploy the service", Path: "/s/deploy.sh"},
+		&Script{ID: "kube", Name: "Kubernetes rollout", Description: "restart pods", Path: "/s/kube.sh"},
+	)
+
+	// BM25 weights the name above the description
+	scripts, err := s.ListScripts(ScriptQuery{Search: "deploy", Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) != 2 || scripts[0].ID != "deploy" || scripts[1].ID != "notes" {
+		t.Fatalf("ranked search = %v, want deploy before notes", scriptIDs(scripts))
+	}
+	if !strings.Contains(scripts[0].Snippet, "<mark>") {
+		t.Errorf("snippet = %q, want a highlighted match", scripts[0].Snippet)
+	}
+
+	// Terms match as prefixes, and every term is required
+	if got := scriptIDs(mustListScripts(t, s, "kuber roll")); len(got) != 1 || got[0] != "kube" {
+		t.Errorf("prefix search = %v, want [kube]", got)
+	}
+	if got := mustListScripts(t, s, "kuber deploy"); len(got) != 0 {
+		t.Errorf("search requiring both terms = %v, want none", scriptIDs(got))
+	}
+}
+
+func mustListScripts(t *testing.T, s *SQLiteStorage, search string) []*Script {
+	t.Helper()
+	scripts, err := s.ListScripts(ScriptQuery{Search: search, Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scripts
+}
+
+func scriptIDs(scripts []*Script) []string {
+	var ids []string
+	for _, script := range scripts {
+		ids = append(ids, script.ID)
+	}
+	return ids
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func newTestStorage(t *testing.T) *SQLiteStorage {
+	t.Helper()
+	s, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "devloop.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	return s
+}
+
+func saveTestScripts(t *testing.T, s *SQLiteStorage, scripts ...*Script) {
+	t.Helper()
+	for _, script := range scripts {
+		if err := s.SaveScript(script); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func searchScriptIDs(t *testing.T, s *SQLiteStorage, search string) []string {
+	t.Helper()
+	scripts, err := s.ListScripts(ScriptQuery{Search: search, Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, script := range scripts {
+		ids = append(ids, script.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TestListScriptsSearch covers matching shared by the FTS5 index and the
+// LIKE fallback; run it with and without -tags sqlite_fts5.
+func TestListScriptsSearch(t *testing.T) {
+	s := newTestStorage(t)
+	saveTestScripts(t, s,
+		&Script{ID: "deploy", Name: "Deploy service", Description: "roll out to kubernetes", Path: "/s/deploy.sh", Tags: []string{"ops"}},
+		&Script{ID: "backup", Name: "Backup database", Description: "dump postgres", Author: "dba", Path: "/s/backup_db.sh"},
+		&Script{ID: "report", Name: "Report", Description: "100% weekly numbers", Path: "/s/report.py", Tags: []string{"mail"}},
+	)
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"deploy", []string{"deploy"}},
+		{"kubernetes", []string{"deploy"}},
+		{"postgres", []string{"backup"}},
+		{"mail", []string{"report"}},
+		{"nothing here", []string{}},
+		// Wildcard characters match themselves, not anything
+		{"_", []string{"backup"}},
+		{"%", []string{"report"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			if got := searchScriptIDs(t, s, tt.search); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("search %q = %v, want %v (fts %v)", tt.search, got, tt.want, s.fts)
+			}
+		})
+	}
+}
+
+func TestSearchExecutionHistory(t *testing.T) {
+	s := newTestStorage(t)
+	entries := []*ExecutionHistory{
+		{ID: "h1", ScriptID: "deploy", Output: "rolled out 100% of pods", Command: "bash deploy.sh",
+			ExecuteRequest: ExecuteRequest{Args: []string{"--region", "eu_west"}, Env: map[string]string{"TOKEN": "hunter2"}, Stdin: "swordfish"}},
+		{ID: "h2", ScriptID: "backup", Output: "dumped database", Command: "bash backup.sh"},
+	}
+	for _, h := range entries {
+		if err := s.SaveExecutionHistory(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"dumped", []string{"h2"}},
+		{"backup.sh", []string{"h2"}},
+		{"eu_west", []string{"h1"}},
+		// Environment and stdin are never searched
+		{"hunter2", []string{}},
+		{"swordfish", []string{}},
+	}
+	if !s.fts {
+		// Wildcard characters match themselves in the LIKE fallback
+		tests = append(tests, struct {
+			query string
+			want  []string
+		}{"%", []string{"h1"}})
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			found, _, err := s.SearchExecutionHistory(HistorySearch{Query: tt.query, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []string{}
+			for _, h := range found {
+				ids = append(ids, h.ID)
+			}
+			sort.Strings(ids)
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("search %q = %v, want %v (fts %v)", tt.query, ids, tt.want, s.fts)
+			}
+		})
+	}
+}
+
+func TestDeleteHistoryByID(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	s := newTestStorage(t)
+	h := &ExecutionHistory{ID: "h1", ScriptID: "deploy", Output: "done", LogFile: outputLogPath("h1")}
+	if err := s.SaveExecutionHistory(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveArtifacts([]*Artifact{{ID: "a1", HistoryID: "h1", Name: "report.txt"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{artifactsDir("h1"), filepath.Dir(outputLogPath("h1"))} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(outputLogPath("h1"), []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteHistoryByID("h1"); err != nil {
+		t.Fatal(err)
+	}
+	if found, _, err := s.SearchExecutionHistory(HistorySearch{Query: "done", Limit: 10}); err != nil || len(found) != 0 {
+		t.Errorf("search after delete = %d entries, %v; want none", len(found), err)
+	}
+	if artifacts, err := s.ListArtifacts("h1"); err != nil || len(artifacts) != 0 {
+		t.Errorf("artifacts after delete = %d, %v; want none", len(artifacts), err)
+	}
+	for _, path := range []string{artifactsDir("h1"), outputLogPath("h1")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after delete: %v", path, err)
+		}
+	}
+	// Deleting an unknown entry is not an error
+	if err := s.DeleteHistoryByID("h1"); err != nil {
+		t.Errorf("second delete = %v", err)
+	}
+}
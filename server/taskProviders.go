@@ -0,0 +1,327 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// taskProvider registers the targets of a project file such as package.json
+// as scripts. Each target is stored with the project file as its path and
+// the target name in Script.Task.
+type taskProvider struct {
+	runner string // also the Script.Runner of the produced scripts
+	match  func(name string) bool
+	parse  func(path, content string) ([]*Script, error)
+}
+
+var taskProviders = []taskProvider{
+	{runner: "npm", match: func(name string) bool { return name == "package.json" }, parse: parsePackageJSON},
+	{runner: "make", match: func(name string) bool { return name == "Makefile" || name == "makefile" || name == "GNUmakefile" }, parse: parseMakefile},
+	{runner: "just", match: func(name string) bool { return strings.EqualFold(name, "justfile") || name == ".justfile" }, parse: parseJustfile},
+}
+
+// taskProviderFor returns the enabled provider for a project file, if any.
+func (c *Config) taskProviderFor(path string) *taskProvider {
+	name := filepath.Base(path)
+	for i, provider := range taskProviders {
+		if containsString(c.TaskProviders, provider.runner) && provider.match(name) {
+			return &taskProviders[i]
+		}
+	}
+	return nil
+}
+
+// newTaskScript builds the script for one target. The fingerprint covers the
+// target and its definition so a moved project keeps the history of each target.
+func newTaskScript(runner, path, project, task, definition string) *Script {
+	return &Script{
+		ID:          md5Hash(path + ":" + task),
+		Name:        task,
+		Category:    project,
+		Tags:        []string{runner},
+		Path:        path,
+		Runner:      runner,
+		Task:        task,
+		Fingerprint: contentFingerprint(runner + ":" + task + "\n" + definition),
+	}
+}
+
+// taskCommand returns the command line running a task with the given inputs.
+// Make variables are passed as NAME=value assignments, just recipe parameters
+// and npm script arguments positionally.
+func taskCommand(script *Script, args []string) ([]string, error) {
+	switch script.Runner {
+	case "npm":
+		argv := []string{"npm", "run", script.Task}
+		if len(args) > 0 {
+			argv = append(append(argv, "--"), args...)
+		}
+		return argv, nil
+	case "make":
+		argv := []string{"make", "-f", script.Path, script.Task}
+		for i, value := range args {
+			switch {
+			case i < len(script.Inputs) && value == "":
+				// Keep the Makefile default
+			case i < len(script.Inputs):
+				argv = append(argv, script.Inputs[i].Name+"="+value)
+			default:
+				argv = append(argv, value)
+			}
+		}
+		return argv, nil
+	case "just":
+		return append([]string{"just", "--justfile", script.Path, script.Task}, args...), nil
+	}
+	return nil, fmt.Errorf("unknown task runner %q", script.Runner)
+}
+
+func parsePackageJSON(path, content string) ([]*Script, error) {
+	var pkg struct {
+		Name    string            `json:"name"`
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal([]byte(content), &pkg); err != nil {
+		return nil, fmt.Errorf("invalid package.json: %w", err)
+	}
+	project := pkg.Name
+	if project == "" {
+		project = filepath.Base(filepath.Dir(path))
+	}
+	names := make([]string, 0, len(pkg.Scripts))
+	for name := range pkg.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var scripts []*Script
+	for _, name := range names {
+		// pre/post hooks run as part of the script they belong to
+		if hook, ok := strings.CutPrefix(name, "pre"); ok && pkg.Scripts[hook] != "" {
+			continue
+		}
+		if hook, ok := strings.CutPrefix(name, "post"); ok && pkg.Scripts[hook] != "" {
+			continue
+		}
+		script := newTaskScript("npm", path, project, name, pkg.Scripts[name])
+		script.Description = pkg.Scripts[name]
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+var (
+	makeVariableRe = regexp.MustCompile(`^(?:export\s+|override\s+)?([A-Za-z_][A-Za-z0-9_]*)\s*(\?=|::=|:=|\+=|=)\s*(.*)$`)
+	makeTargetRe   = regexp.MustCompile(`^([A-Za-z0-9_][A-Za-z0-9_./ -]*?)\s*::?(?:\s+(.*))?$`)
+	makeRefRe      = regexp.MustCompile(`\$[({]([A-Za-z_][A-Za-z0-9_]*)[)}]`)
+)
+
+// parseMakefile registers explicit targets. A "## text" suffix or the comment
+// above a target becomes its description, and variables assigned at the top
+// level that its recipe references become inputs.
+func parseMakefile(path, content string) ([]*Script, error) {
+	type target struct {
+		name, description, prerequisites string
+		recipe                           []string
+	}
+	type variable struct {
+		value, description string
+	}
+	var (
+		targets   []*target
+		current   []*target
+		variables = make(map[string]variable)
+		comment   []string
+	)
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, "\t") {
+			for _, t := range current {
+				t.recipe = append(t.recipe, strings.TrimSpace(line))
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") {
+			comment = append(comment, strings.TrimSpace(strings.TrimLeft(trimmed, "#")))
+			continue
+		}
+		description := strings.Join(comment, " ")
+		comment = nil
+		if trimmed == "" {
+			continue
+		}
+		current = nil
+		if m := makeVariableRe.FindStringSubmatch(line); m != nil {
+			if _, ok := variables[m[1]]; !ok && m[2] != "+=" {
+				variables[m[1]] = variable{value: strings.TrimSpace(m[3]), description: description}
+			}
+			continue
+		}
+		m := makeTargetRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		prerequisites, help, found := strings.Cut(m[2], "##")
+		if found {
+			description = strings.TrimSpace(help)
+		}
+		for _, name := range strings.Fields(m[1]) {
+			if strings.HasPrefix(name, ".") {
+				continue // special targets such as .PHONY
+			}
+			t := &target{name: name, description: description, prerequisites: prerequisites}
+			targets = append(targets, t)
+			current = append(current, t)
+		}
+	}
+
+	project := filepath.Base(filepath.Dir(path))
+	var scripts []*Script
+	seen := make(map[string]struct{})
+	for _, t := range targets {
+		if _, ok := seen[t.name]; ok {
+			continue
+		}
+		seen[t.name] = struct{}{}
+		recipe := strings.Join(t.recipe, "\n")
+		script := newTaskScript("make", path, project, t.name, t.prerequisites+"\n"+recipe)
+		script.Description = t.description
+		referenced := make(map[string]struct{})
+		for _, ref := range makeRefRe.FindAllStringSubmatch(t.prerequisites+"\n"+recipe, -1) {
+			v, ok := variables[ref[1]]
+			if _, done := referenced[ref[1]]; !ok || done {
+				continue
+			}
+			referenced[ref[1]] = struct{}{}
+			script.Inputs = append(script.Inputs, Input{Name: ref[1], Description: v.description, Type: "string", Default: v.value})
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+// justRecipeHeader splits a justfile recipe line into its name and parameters,
+// honouring quoted defaults. ok is false for lines that are not recipe headers.
+func justRecipeHeader(line string) (name string, params []string, ok bool) {
+	var (
+		tokens []string
+		token  strings.Builder
+		quote  rune
+	)
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			token.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+			token.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		case r == ':':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				return "", nil, false // variable assignment
+			}
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+			}
+			if len(tokens) == 0 {
+				return "", nil, false
+			}
+			return strings.TrimPrefix(tokens[0], "@"), tokens[1:], true
+		default:
+			token.WriteRune(r)
+		}
+	}
+	return "", nil, false
+}
+
+var justDocRe = regexp.MustCompile(`^\[doc\(\s*["'](.*)["']\s*\)\]$`)
+
+// parseJustfile registers public recipes, with the comment or [doc] attribute
+// above a recipe as its description and its parameters as inputs.
+func parseJustfile(path, content string) ([]*Script, error) {
+	var (
+		scripts []*Script
+		current *Script
+		body    []string
+		comment []string
+		doc     string
+		private bool
+	)
+	finish := func() {
+		if current != nil {
+			current.Fingerprint = contentFingerprint("just:" + current.Task + "\n" + strings.Join(body, "\n"))
+			scripts = append(scripts, current)
+		}
+		current, body = nil, nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if current != nil {
+				body = append(body, strings.TrimSpace(line))
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			comment = nil
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			comment = append(comment, strings.TrimSpace(strings.TrimLeft(trimmed, "#")))
+			continue
+		case strings.HasPrefix(trimmed, "["):
+			if m := justDocRe.FindStringSubmatch(trimmed); m != nil {
+				doc = m[1]
+			}
+			if strings.Contains(trimmed, "private") {
+				private = true
+			}
+			continue
+		}
+		finish()
+		description := strings.Join(comment, " ")
+		if doc != "" {
+			description = doc
+		}
+		isPrivate := private
+		comment, doc, private = nil, "", false
+		for _, keyword := range []string{"set ", "alias ", "import ", "mod ", "export "} {
+			if strings.HasPrefix(trimmed, keyword) {
+				trimmed = ""
+			}
+		}
+		name, params, ok := justRecipeHeader(trimmed)
+		if !ok || isPrivate || strings.HasPrefix(name, "_") {
+			continue
+		}
+		current = newTaskScript("just", path, filepath.Base(filepath.Dir(path)), name, "")
+		current.Description = description
+		for _, param := range params {
+			param = strings.TrimPrefix(param, "$")
+			// "*name" takes zero or more values, "+name" one or more
+			optional := strings.HasPrefix(param, "*")
+			param = strings.TrimLeft(param, "*+$")
+			paramName, value, hasDefault := strings.Cut(param, "=")
+			input := Input{Name: paramName, Type: "string", Required: !hasDefault && !optional}
+			if hasDefault {
+				input.Default = strings.Trim(value, "\"'")
+			}
+			current.Inputs = append(current.Inputs, input)
+		}
+	}
+	finish()
+	return scripts, nil
+}
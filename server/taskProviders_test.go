@@ -0,0 +1,183 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+// taskSummary is the part of a task script the parsers decide.
+type taskSummary struct {
+	Name        string
+	Description string
+	Inputs      []Input
+}
+
+func summarizeTasks(scripts []*Script) []taskSummary {
+	var summaries []taskSummary
+	for _, s := range scripts {
+		summaries = append(summaries, taskSummary{Name: s.Name, Description: s.Description, Inputs: s.Inputs})
+	}
+	return summaries
+}
+
+func TestParsePackageJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []taskSummary
+		project string
+		wantErr bool
+	}{
+		{
+			name:    "scripts sorted with hooks folded in",
+			content: `{"name": "web", "scripts": {"test": "vitest", "build": "vite build", "prebuild": "tsc", "postinstall": "patch", "preview": "vite preview"}}`,
+			want: []taskSummary{
+				{Name: "build", Description: "vite build"},
+				{Name: "postinstall", Description: "patch"},
+				{Name: "preview", Description: "vite preview"},
+				{Name: "test", Description: "vitest"},
+			},
+			project: "web",
+		},
+		{
+			name:    "project falls back to the folder name",
+			content: `{"scripts": {"start": "node ."}}`,
+			want:    []taskSummary{{Name: "start", Description: "node ."}},
+			project: "app",
+		},
+		{name: "no scripts", content: `{"name": "lib"}`},
+		{name: "invalid JSON", content: `{"scripts": `, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scripts, err := parsePackageJSON("/src/app/package.json", tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := summarizeTasks(scripts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tasks = %+v, want %+v", got, tt.want)
+			}
+			for _, s := range scripts {
+				if s.Category != tt.project || s.Runner != "npm" || s.Task != s.Name {
+					t.Errorf("task %q has category %q runner %q task %q", s.Name, s.Category, s.Runner, s.Task)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMakefile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []taskSummary
+	}{
+		{
+			name:    "help comments and comments above targets",
+			content: ".PHONY: build test\n\n# Compile everything\nbuild:\n\tgo build ./...\n\ntest: build ## Run the tests\n\tgo test ./...\n",
+			want: []taskSummary{
+				{Name: "build", Description: "Compile everything"},
+				{Name: "test", Description: "Run the tests"},
+			},
+		},
+		{
+			name:    "referenced variables become inputs",
+			content: "# Target cluster\nCLUSTER ?= dev\nIMAGE := app\nIMAGE += extra\nUNUSED = 1\n\ndeploy: ## Deploy\n\tkubectl --context $(CLUSTER) set image $(IMAGE) ${CLUSTER}\n",
+			want: []taskSummary{{Name: "deploy", Description: "Deploy", Inputs: []Input{
+				{Name: "CLUSTER", Description: "Target cluster", Type: "string", Default: "dev"},
+				{Name: "IMAGE", Type: "string", Default: "app"},
+			}}},
+		},
+		{
+			name:    "several targets share a rule and duplicates are dropped",
+			content: "a b: c\n\techo $@\n\na:\n\techo again\n",
+			want:    []taskSummary{{Name: "a"}, {Name: "b"}},
+		},
+		{
+			name:    "special targets and double colon rules",
+			content: ".DEFAULT_GOAL := all\n.SUFFIXES:\nall::\n\techo\n",
+			want:    []taskSummary{{Name: "all"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scripts, err := parseMakefile("/src/proj/Makefile", tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summarizeTasks(scripts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tasks = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJustfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []taskSummary
+	}{
+		{
+			name:    "comments, doc attributes and private recipes",
+			content: "set shell := [\"bash\", \"-c\"]\nalias b := build\n\n# Build it\nbuild:\n    cargo build\n\n[doc('Run tests')]\ntest: build\n    cargo test\n\n[private]\nhidden:\n    true\n\n_helper:\n    true\n",
+			want: []taskSummary{
+				{Name: "build", Description: "Build it"},
+				{Name: "test", Description: "Run tests"},
+			},
+		},
+		{
+			name:    "parameters",
+			content: "deploy env target=\"web: api\" *flags:\n    echo {{env}}\n@quiet +files:\n    echo\n",
+			want: []taskSummary{
+				{Name: "deploy", Inputs: []Input{
+					{Name: "env", Type: "string", Required: true},
+					{Name: "target", Type: "string", Default: "web: api"},
+					{Name: "flags", Type: "string"},
+				}},
+				{Name: "quiet", Inputs: []Input{{Name: "files", Type: "string", Required: true}}},
+			},
+		},
+		{
+			name:    "blank line separates comment from recipe",
+			content: "# unrelated\n\nrun:\n    true\n",
+			want:    []taskSummary{{Name: "run"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scripts, err := parseJustfile("/src/proj/justfile", tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summarizeTasks(scripts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tasks = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		script *Script
+		args   []string
+		want   []string
+	}{
+		{"npm", &Script{Runner: "npm", Task: "test"}, []string{"--watch"}, []string{"npm", "run", "test", "--", "--watch"}},
+		{"npm without args", &Script{Runner: "npm", Task: "test"}, nil, []string{"npm", "run", "test"}},
+		{"make variables", &Script{Runner: "make", Task: "deploy", Path: "/p/Makefile", Inputs: []Input{{Name: "CLUSTER"}, {Name: "IMAGE"}}}, []string{"prod", "", "extra"}, []string{"make", "-f", "/p/Makefile", "deploy", "CLUSTER=prod", "extra"}},
+		{"just", &Script{Runner: "just", Task: "deploy", Path: "/p/justfile"}, []string{"prod"}, []string{"just", "--justfile", "/p/justfile", "deploy", "prod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := taskCommand(tt.script, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("taskCommand = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// EventSource and WebSocket clients cannot set headers, so they authenticate
+// streams with a ticket in the query string instead of the API key, which
+// would otherwise end up in access logs. A ticket is issued to a client that
+// holds the key, expires after streamTicketTTL and opens one stream.
+const streamTicketTTL = 30 * time.Second
+
+var streamTickets = struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}{expires: make(map[string]time.Time)}
+
+// issueStreamTicket returns a new ticket and drops expired ones.
+func issueStreamTicket() (string, time.Time) {
+	ticket := uuid.New().String()
+	expiresAt := time.Now().Add(streamTicketTTL)
+	streamTickets.mu.Lock()
+	defer streamTickets.mu.Unlock()
+	for t, exp := range streamTickets.expires {
+		if time.Now().After(exp) {
+			delete(streamTickets.expires, t)
+		}
+	}
+	streamTickets.expires[ticket] = expiresAt
+	return ticket, expiresAt
+}
+
+// redeemStreamTicket reports whether ticket is valid, consuming it.
+func redeemStreamTicket(ticket string) bool {
+	if ticket == "" {
+		return false
+	}
+	streamTickets.mu.Lock()
+	defer streamTickets.mu.Unlock()
+	exp, ok := streamTickets.expires[ticket]
+	delete(streamTickets.expires, ticket)
+	return ok && time.Now().Before(exp)
+}
+
+// isStreamPath reports whether path is an event stream or run attachment,
+// the endpoints that accept a ticket.
+func isStreamPath(path string) bool {
+	return path == "/api/events" || (strings.HasPrefix(path, "/api/runs/") && (strings.HasSuffix(path, "/tty") || strings.HasSuffix(path, "/attach")))
+}
+
+func createStreamTicketHandler(c *gin.Context) {
+	ticket, expiresAt := issueStreamTicket()
+	c.JSON(http.StatusCreated, gin.H{"ticket": ticket, "expiresAt": expiresAt})
+}
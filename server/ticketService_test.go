@@ -0,0 +1,27 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamTickets(t *testing.T) {
+	ticket, _ := issueStreamTicket()
+	if !redeemStreamTicket(ticket) {
+		t.Fatal("a new ticket was rejected")
+	}
+	if redeemStreamTicket(ticket) {
+		t.Error("a ticket was accepted twice")
+	}
+	if redeemStreamTicket("") || redeemStreamTicket("made-up") {
+		t.Error("an unknown ticket was accepted")
+	}
+
+	expired, _ := issueStreamTicket()
+	streamTickets.mu.Lock()
+	streamTickets.expires[expired] = time.Now().Add(-time.Second)
+	streamTickets.mu.Unlock()
+	if redeemStreamTicket(expired) {
+		t.Error("an expired ticket was accepted")
+	}
+}
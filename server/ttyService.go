@@ -0,0 +1,182 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// defaultTerm is the TERM of TTY runs when neither the server nor the run sets one.
+const defaultTerm = "xterm-256color"
+
+// startTTY starts a resolved execution under a pseudo-terminal and registers
+// it as job j, which clients attach to with attachHandler. stdin is typed
+// into the terminal once it starts. onExit is called with the exit code once
+// the process ends; the transcript is in the job's output spool.
+func startTTY(j *job, run *execution, cols, rows uint16, stdin string, onExit func(exitCode int)) error {
+	if cols == 0 || rows == 0 {
+		cols, rows = 80, 24
+	}
+	cmd := exec.Command(run.argv[0], run.argv[1:]...)
+	cmd.Dir = run.dir
+	cmd.Env = run.environ()
+	if !hasEnv(cmd.Env, "TERM") {
+		cmd.Env = append(cmd.Env, "TERM="+defaultTerm)
+	}
+	terminal, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: cols, Rows: rows})
+	if err != nil {
+		return err
+	}
+
+	j.TTY = true
+	j.input = terminal
+	j.closeIn = func() error {
+		// A terminal has no end of input; send Ctrl-D as a user would
+		_, err := terminal.Write([]byte{4})
+		return err
+	}
+	j.resize = func(cols, rows uint16) error {
+		return pty.Setsize(terminal, &pty.Winsize{Cols: cols, Rows: rows})
+	}
+	if stdin != "" {
+		j.writeInitialInput([]byte(stdin))
+	}
+	jobs.add(j)
+	go func() {
+		// Reading ends once every process holding the terminal closes it,
+		// which a background child may never do, so the run ends with the
+		// process and the rest of the output gets outputDrainTimeout
+		copied := make(chan struct{})
+		go func() {
+			io.Copy(j, terminal)
+			close(copied)
+		}()
+		exitCode := 0
+		if err := cmd.Wait(); err != nil {
+			exitCode = -1
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				exitCode = exitErr.ExitCode()
+			}
+		}
+		select {
+		case <-copied:
+		case <-time.After(outputDrainTimeout):
+		}
+		terminal.Close()
+		onExit(exitCode)
+		j.finish(exitCode)
+		jobs.remove(j.ID)
+	}()
+	return nil
+}
+
+// hasEnv reports whether env, in "NAME=value" form, sets name.
+func hasEnv(env []string, name string) bool {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// attachMessage is a message from an attached client: input to send to the
+// process, the end of input, or the new size of the client's terminal.
+type attachMessage struct {
+	Type string `json:"type"` // "input", "eof" or "resize"
+	Data string `json:"data,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
+
+// attachHandler attaches a WebSocket client to a running background job. The
+// client first receives the output so far, then raw output as binary
+// messages and finally {"type":"exit","exitCode":n}.
+func attachHandler(c *gin.Context) {
+	j := jobs.get(c.Param("id"))
+	if j == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "run not found or already finished"})
+		return
+	}
+	websocket.Server{
+		Handshake: checkAttachOrigin,
+		Handler:   func(ws *websocket.Conn) { serveAttach(ws, j) },
+	}.ServeHTTP(c.Writer, c.Request)
+}
+
+// checkAttachOrigin rejects WebSocket handshakes from other sites, which
+// browsers allow without CORS and which would otherwise let any page type
+// into a running job when no API key is set. Clients without an Origin
+// header, the server's own origin, loopback hosts and the desktop app are
+// accepted.
+func checkAttachOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	config.Origin = u
+	host := u.Hostname()
+	switch {
+	case u.Scheme == "wails", u.Host == r.Host, host == "localhost", strings.HasSuffix(host, ".localhost"):
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+func serveAttach(ws *websocket.Conn, j *job) {
+	defer ws.Close()
+	transcript, output := j.attach()
+	defer j.detach(output)
+
+	go func() {
+		for {
+			var msg attachMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				ws.Close()
+				return
+			}
+			switch msg.Type {
+			case "input":
+				j.writeInput([]byte(msg.Data))
+			case "eof":
+				j.closeInput()
+			case "resize":
+				if j.resize != nil && msg.Cols > 0 && msg.Rows > 0 {
+					j.resize(msg.Cols, msg.Rows)
+				}
+			}
+		}
+	}()
+
+	if len(transcript) > 0 {
+		if err := websocket.Message.Send(ws, transcript); err != nil {
+			return
+		}
+	}
+	for chunk := range output {
+		if err := websocket.Message.Send(ws, chunk); err != nil {
+			return
+		}
+	}
+	if exited, exitCode := j.wait(); exited {
+		websocket.JSON.Send(ws, gin.H{"type": "exit", "exitCode": exitCode})
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce groups bursts of file events (editors often write a file
+// several times on save) into a single reload.
+const watchDebounce = 300 * time.Millisecond
+
+// scriptWatcher reloads scripts when files change in the configured folders.
+type scriptWatcher struct {
+	watcher *fsnotify.Watcher
+	walkers []*scriptWalker // one per script folder, so ignored folders are not watched
+	timer   *time.Timer
+	closed  bool // set by close, after which no reload is scheduled or run
+	mu      sync.Mutex
+}
+
+var (
+	activeWatcher   *scriptWatcher
+	activeWatcherMu sync.Mutex
+)
+
+// watchScriptFolders (re)starts watching every configured script folder.
+// It is called on startup and whenever the config changes.
+func watchScriptFolders(cfg *Config) {
+	activeWatcherMu.Lock()
+	defer activeWatcherMu.Unlock()
+	if activeWatcher != nil {
+		activeWatcher.close()
+		activeWatcher = nil
+	}
+	if cfg.DisableWatch {
+		return
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("watchScriptFolders: failed to create watcher: %v", err)
+		return
+	}
+	w := &scriptWatcher{watcher: fsw}
+	for _, folder := range cfg.ScriptFolders {
+		root := expandHome(folder)
+		w.walkers = append(w.walkers, newScriptWalker(root, cfg))
+		w.addRecursive(root)
+	}
+	activeWatcher = w
+	go w.run()
+}
+
+// addRecursive watches a folder and all of its subfolders that are not ignored.
+func (w *scriptWatcher) addRecursive(dir string) {
+	for _, walker := range w.walkers {
+		if dir != walker.root && !strings.HasPrefix(dir, walker.root+string(filepath.Separator)) {
+			continue
+		}
+		if dir != walker.root && walker.skip(dir, true) {
+			return
+		}
+		walker.walk(dir, func(name string, d fs.DirEntry) error {
+			if !d.IsDir() {
+				return nil
+			}
+			if err := w.watcher.Add(name); err != nil {
+				log.Printf("scriptWatcher: failed to watch %s: %v", name, err)
+			}
+			return nil
+		})
+		return
+	}
+}
+
+func (w *scriptWatcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					w.addRecursive(event.Name)
+				}
+			}
+			w.schedule()
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("scriptWatcher: %v", err)
+		}
+	}
+}
+
+func (w *scriptWatcher) schedule() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(watchDebounce, w.reload)
+}
+
+func (w *scriptWatcher) reload() {
+	w.mu.Lock()
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return
+	}
+	report, err := reloadScripts(nil, false)
+	if err != nil {
+		log.Printf("scriptWatcher: reload failed: %v", err)
+		return
+	}
+	if report.changed() {
+		log.Printf("scriptWatcher: scripts changed: %v", report.counts())
+		events.publish("scripts.changed", report)
+	}
+}
+
+func (w *scriptWatcher) close() {
+	w.mu.Lock()
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	w.watcher.Close()
+}